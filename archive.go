@@ -0,0 +1,293 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+)
+
+// archiveTypes are the install types whose artifact is unpacked
+var archiveTypes = map[string]bool{
+	"zip":     true,
+	"tar.gz":  true,
+	"tar.xz":  true,
+	"tar.bz2": true,
+	"gzip":    true,
+}
+
+// detectInstallType works out the install type of a downloaded artifact from
+// its first bytes, for manifests that leave "install" out. Files that aren't
+// a known archive or installer are treated as executables.
+func detectInstallType(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	header := make([]byte, 8)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return "zip", nil
+	case bytes.HasPrefix(header, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return "tar.xz", nil
+	case bytes.HasPrefix(header, []byte("BZh")):
+		return "tar.bz2", nil
+	case bytes.HasPrefix(header, []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}):
+		// msi installers are OLE compound files
+		return "setup", nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		// a tar inside has "ustar" at offset 257 of the decompressed data
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return "", err
+		}
+		defer gz.Close()
+		block := make([]byte, 512)
+		if n, _ := io.ReadFull(gz, block); n >= 262 && string(block[257:262]) == "ustar" {
+			return "tar.gz", nil
+		}
+		return "gzip", nil
+	}
+	return "exe", nil
+}
+
+// decompressor returns a reader for the tar stream inside a compressed file
+func decompressor(installType string, r io.Reader) (io.Reader, error) {
+	switch installType {
+	case "tar.gz":
+		return gzip.NewReader(r)
+	case "tar.xz":
+		return xz.NewReader(r)
+	case "tar.bz2":
+		return bzip2.NewReader(r), nil
+	}
+	return nil, fmt.Errorf("'%s' is not a tar archive type", installType)
+}
+
+// Unzip unpacks a zip archive into dest. Paths and symbolic links must stay
+// inside dest, and the size and file count limits of the extractor apply.
+func Unzip(src, dest string) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	e, err := newExtractor(dest)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range r.File {
+		if err := unzipFile(e, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unzipFile(e *extractor, f *zip.File) error {
+	mode := f.Mode()
+	if mode.IsDir() {
+		return e.Dir(f.Name, mode)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if mode&os.ModeSymlink != 0 {
+		// the link target is the content of the entry
+		target, err := io.ReadAll(io.LimitReader(rc, 4096))
+		if err != nil {
+			return err
+		}
+		return e.Symlink(f.Name, string(target))
+	}
+	if !mode.IsRegular() {
+		return nil
+	}
+	return e.File(f.Name, rc, mode)
+}
+
+// Untar unpacks a compressed tar archive into dest with the same checks as
+// Unzip. File permissions are kept and symbolic links are recreated.
+func Untar(src, dest, installType string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stream, err := decompressor(installType, bufio.NewReader(file))
+	if err != nil {
+		return err
+	}
+
+	e, err := newExtractor(dest)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(stream)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		mode := os.FileMode(header.Mode)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = e.Dir(header.Name, mode)
+		case tar.TypeReg, tar.TypeRegA:
+			err = e.File(header.Name, tr, mode)
+		case tar.TypeSymlink:
+			err = e.Symlink(header.Name, header.Linkname)
+		case tar.TypeLink:
+			err = e.Link(header.Name, header.Linkname)
+		default:
+			// devices, fifos and the like have no place in a package
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// unpackArchive unpacks a zip or tar archive into dir and deletes it. The
+// archive is unpacked into a temporary folder first, and then moved into
+// place according to the release's extract_dir and strip_components.
+func unpackArchive(pkg *Manifest, archivePath, dir string) error {
+	tmp, err := os.MkdirTemp(dir, ".unpack-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if pkg.Install == "zip" {
+		err = Unzip(archivePath, tmp)
+	} else {
+		err = Untar(archivePath, tmp, pkg.Install)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(archivePath); err != nil {
+		return fmt.Errorf("removing archive: %w", err)
+	}
+
+	if err := placeArchive(pkg, tmp, dir); err != nil {
+		return err
+	}
+	return checkLinks(dir)
+}
+
+// placeArchive moves the unpacked archive in tmp into dir according to the
+// release's extract_dir and strip_components
+func placeArchive(pkg *Manifest, tmp, dir string) error {
+	release := &pkg.Release
+	switch {
+	case release.ExtractDir != "":
+		root := filepath.Join(tmp, filepath.FromSlash(release.ExtractDir))
+		if info, err := os.Lstat(root); err != nil || !info.IsDir() || !insideDir(tmp, root) {
+			return fmt.Errorf("extract_dir '%s' is not a folder in the archive", release.ExtractDir)
+		}
+		return mergeDir(root, dir)
+	case release.StripComponents != nil:
+		return stripComponents(tmp, dir, *release.StripComponents)
+	}
+
+	// most archives keep everything in one folder such as "tool-1.0/",
+	// which is stripped unless the main program is found without stripping it
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		if _, err := os.Lstat(filepath.Join(tmp, filepath.FromSlash(pkg.Bins()[0].Path))); err != nil {
+			return mergeDir(filepath.Join(tmp, entries[0].Name()), dir)
+		}
+	}
+	return mergeDir(tmp, dir)
+}
+
+// stripComponents moves what is n folders deep in src into dst, like
+// tar --strip-components. Files less than n folders deep are dropped.
+func stripComponents(src, dst string, n int) error {
+	if n == 0 {
+		return mergeDir(src, dst)
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if err := stripComponents(filepath.Join(src, entry.Name()), dst, n-1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Gunzip unpacks a single gzip compressed file into dir and returns its
+// name: the original name stored in the gzip header, or the artifact's name
+// without ".gz". The file is made executable, as plain gzip artifacts are
+// almost always a single program.
+func Gunzip(src, dir string) (string, error) {
+	file, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return "", err
+	}
+	defer gz.Close()
+
+	name := filepath.Base(gz.Name)
+	if gz.Name == "" || name == "." || name == ".." || name == string(os.PathSeparator) {
+		name = strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+	}
+	if filepath.Join(dir, name) == filepath.Clean(src) {
+		return "", fmt.Errorf("can't unpack %s onto itself", name)
+	}
+
+	e, err := newExtractor(dir)
+	if err != nil {
+		return "", err
+	}
+	if err := e.File(name, gz, 0755); err != nil {
+		return "", err
+	}
+	return name, nil
+}
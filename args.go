@@ -0,0 +1,67 @@
+package main
+
+import "strings"
+
+// Args holds a command's positional arguments and its --flags
+type Args struct {
+	Positional []string
+	Flags      map[string]string
+}
+
+// parseArgs splits command-line arguments into positional arguments and
+// flags. Flags are written as --name or --name=value; flags listed in
+// valueFlags may also take their value from the next argument
+// (--name value). Everything after a bare "--" is positional.
+func parseArgs(args []string, valueFlags ...string) Args {
+	takesValue := make(map[string]bool)
+	for _, name := range valueFlags {
+		takesValue[name] = true
+	}
+
+	parsed := Args{Flags: make(map[string]string)}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			parsed.Positional = append(parsed.Positional, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "--") || len(arg) == 2 {
+			parsed.Positional = append(parsed.Positional, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(arg[2:], "=")
+		if !hasValue {
+			value = "true"
+			if takesValue[name] && i+1 < len(args) {
+				value = args[i+1]
+				i++
+			}
+		}
+		parsed.Flags[name] = value
+	}
+
+	return parsed
+}
+
+// Bool reports whether a flag was given and not set to false
+func (a Args) Bool(name string) bool {
+	value, ok := a.Flags[name]
+	return ok && value != "false"
+}
+
+// String returns a flag's value, or def when it wasn't given
+func (a Args) String(name, def string) string {
+	if value, ok := a.Flags[name]; ok {
+		return value
+	}
+	return def
+}
+
+// Arg returns the i-th positional argument, or "" when there are fewer
+func (a Args) Arg(i int) string {
+	if i < len(a.Positional) {
+		return a.Positional[i]
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// autoremove uninstalls packages that were only installed as dependencies
+// and that no explicitly installed package needs any more
+func autoremove() {
+	args := parseArgs(os.Args[2:])
+
+	installed, err := loadInstalled()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	orphans := findOrphans(installed)
+	if len(orphans) == 0 {
+		fmt.Println("No unneeded packages to remove.")
+		return
+	}
+
+	removeOrphans(orphans, args.Bool("dry-run"))
+}
+
+// removeOrphans uninstalls the given packages, or only lists them on a dry run
+func removeOrphans(orphans []string, dryRun bool) {
+	if dryRun {
+		fmt.Println("Would remove these unneeded packages:")
+		for _, name := range orphans {
+			fmt.Println("  " + name)
+		}
+		return
+	}
+
+	for _, name := range orphans {
+		if err := uninstallPackage(name); err != nil {
+			fmt.Printf("Error uninstalling package '%s': %s\n", name, err)
+			continue
+		}
+		if err := removefromInstalled(name); err != nil {
+			fmt.Printf("Error removing package '%s' from installed.json: %s\n", name, err)
+			continue
+		}
+		fmt.Printf("Package '%s' uninstalled successfully.\n", name)
+	}
+}
+
+// findOrphans returns, sorted by name, the packages installed as
+// dependencies that can't be reached from any explicitly installed package
+// through the dependencies of the current versions
+func findOrphans(db *InstalledDB) []string {
+	needed := make(map[string]bool)
+	var queue []*InstalledPackage
+	for i := range db.Packages {
+		if db.Packages[i].Explicit() {
+			needed[db.Packages[i].Name] = true
+			queue = append(queue, &db.Packages[i])
+		}
+	}
+
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+		for _, dep := range pkg.Depends {
+			d, err := parseDependency(dep)
+			if err != nil {
+				continue
+			}
+			// every provider of a virtual name counts as needed
+			for _, record := range db.Providers(d.Name) {
+				if !needed[record.Name] {
+					needed[record.Name] = true
+					queue = append(queue, record)
+				}
+			}
+		}
+	}
+
+	var orphans []string
+	for _, pkg := range db.Packages {
+		if !needed[pkg.Name] {
+			orphans = append(orphans, pkg.Name)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans
+}
+
+// newOrphans returns the packages that become orphans once name is removed
+func newOrphans(db *InstalledDB, name string) []string {
+	before := make(map[string]bool)
+	for _, orphan := range findOrphans(db) {
+		before[orphan] = true
+	}
+
+	after := &InstalledDB{Schema: db.Schema}
+	for _, pkg := range db.Packages {
+		if pkg.Name != name {
+			after.Packages = append(after.Packages, pkg)
+		}
+	}
+
+	var orphans []string
+	for _, orphan := range findOrphans(after) {
+		if !before[orphan] {
+			orphans = append(orphans, orphan)
+		}
+	}
+	return orphans
+}
+
+// dependents returns the installed packages whose current version needs name,
+// directly or through a virtual name it provides
+func dependents(db *InstalledDB, name string) []string {
+	record := db.Find(name)
+	var names []string
+	for _, pkg := range db.Packages {
+		for _, dep := range pkg.Depends {
+			if d, err := parseDependency(dep); err == nil && record != nil && record.ProvidesName(name, d.Name) {
+				names = append(names, pkg.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+func quoteNames(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = "'" + name + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -2,31 +2,18 @@
 package main
 
 import (
-	"archive/zip"
-	"encoding/json"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
-	"net/http"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"slices"
 	"strings"
 	"text/tabwriter"
-
-	"github.com/schollz/progressbar/v3"
 )
 
-const url = "https://raw.githubusercontent.com/jooapa/BOOM/main/db.json"
-
 var currentUser, err = user.Current()
 
-var install_type = ""
-var executable_name = ""
-var installed_file_name = ""
-
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("Usage: boom <command> [arguments]")
@@ -35,11 +22,21 @@ func main() {
 		fmt.Println("  run       run a program")
 		fmt.Println("  install   install a program")
 		fmt.Println("  uninstall uninstall a program")
+		fmt.Println("  autoremove uninstall dependencies nothing needs any more")
 		fmt.Println("  update    update a program")
+		fmt.Println("  switch    switch between installed versions")
+		fmt.Println("  hold      keep a program on its current version")
+		fmt.Println("  unhold    let a held program update again")
+		fmt.Println("  outdated  list programs with newer versions available")
 		fmt.Println("  list      list all programs installed")
 		fmt.Println("  search    search a program")
 		fmt.Println("  init	     initialize BOOM")
 		fmt.Println("  start     open .boom directory in file explorer")
+		fmt.Println("  key       manage trusted registry signing keys")
+		fmt.Println("  registry  manage package registries")
+		fmt.Println("  refresh   re-download all registry indexes")
+		fmt.Println("  cache     list, measure or clean the download cache")
+		fmt.Println("  shims     rebuild the launchers in ~/.boom/shims")
 
 		return
 	}
@@ -52,17 +49,41 @@ func main() {
 	// command
 	cmd := os.Args[1]
 
+	// only one boom process may change ~/.boom at a time
+	if needsLock(os.Args[1:]) {
+		unlock, err := lockBoom()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		defer unlock()
+		recoverTransactions()
+	}
+
 	switch cmd {
 	case "version":
 		version()
 	case "run":
-		run()
+		// scripts see the exit code of the program
+		if code := run(); code != 0 {
+			os.Exit(code)
+		}
 	case "install":
 		install()
 	case "uninstall":
 		uninstall()
+	case "autoremove":
+		autoremove()
 	case "update":
 		update()
+	case "switch":
+		switchVersion()
+	case "hold":
+		setHold(true)
+	case "unhold":
+		setHold(false)
+	case "outdated":
+		outdated()
 	case "list":
 		list()
 	case "search":
@@ -71,6 +92,16 @@ func main() {
 		initialize()
 	case "start":
 		start()
+	case "key":
+		keyCommand()
+	case "registry":
+		registryCommand()
+	case "refresh":
+		refresh()
+	case "cache":
+		cacheCommand()
+	case "shims":
+		shimsCommand()
 	default:
 		fmt.Println("Unknown command:", cmd, "\n", "Run 'boom' for usage.")
 	}
@@ -88,182 +119,266 @@ func start() {
 	}
 }
 
-func run() {
-	if len(os.Args) < 3 {
-		fmt.Println("Usage: boom run <package>")
+func install() {
+	args := parseArgs(os.Args[2:], "jobs")
+	if len(args.Positional) < 1 {
+		fmt.Println("Usage: boom install [registry/]<package>[@version]... [--replace] [--jobs n] [--insecure] [--offline]")
 		return
 	}
 
-	// Path to the installed.json file
-	installedFile := currentUser.HomeDir + "/.boom/installed.json"
-
-	// Open and read the JSON file
-	jsonFile, err := os.Open(installedFile)
+	jobs, err := downloadJobs(args.String("jobs", ""))
 	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
-	defer jsonFile.Close()
 
-	// get the package name from the command-line arguments
-	package_name := os.Args[2]
-
-	// get package_name property name and executeble property name
-	var package_name_property_name string
-	var executeble_property_name string
+	index, err := loadIndex(IndexOptions{Insecure: args.Bool("insecure"), Offline: args.Bool("offline")})
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
 
-	// Decode the JSON data into a map
-	var installedData map[string][]map[string]interface{}
-	decoder := json.NewDecoder(jsonFile)
-	if err := decoder.Decode(&installedData); err != nil {
+	installed, err := loadInstalled()
+	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
 
-	// Loop through the data and print the "name" property
-	for _, programs := range installedData {
-		for _, program := range programs {
-			name, exists := program["name"].(string)
-			if exists {
-				if name == package_name {
-					package_name_property_name = name
-					executeble_property_name = program["executeble"].(string)
+	var roots []*IndexEntry
+	explicit := make(map[string]bool)
+	promoted := false
+	for _, arg := range args.Positional {
+		// name@1.2.2, name@^1.2 or name@latest
+		ref, spec, _ := strings.Cut(arg, "@")
+		entry, ok := index.Find(ref)
+		if !ok {
+			fmt.Printf("Package '%s' not found in any registry%s.\n", ref, index.skippedNote())
+			return
+		}
+		if err := index.checkShadowed(ref, entry); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		entry, err = entry.Resolve(spec)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if explicit[entry.Name] {
+			if i := slices.IndexFunc(roots, func(root *IndexEntry) bool { return root.Name == entry.Name }); roots[i].Version != entry.Version {
+				fmt.Printf("Package '%s' was requested as both %s and %s.\n", entry.Name, roots[i].Version, entry.Version)
+				return
+			}
+			continue
+		}
+
+		// Check if this version is already installed
+		if record := installed.Find(entry.Name); record != nil {
+			if record.Version == entry.Version {
+				fmt.Printf("Package '%s' is already installed (version %s).\n", entry.Name, record.Version)
+				// asking for a dependency by name makes it an explicit install
+				if !record.Explicit() {
+					record.Reason = reasonExplicit
+					promoted = true
 				}
-			} else {
-				fmt.Println("Name not found for program:", program)
+				continue
+			}
+			// like update, install leaves held packages on their version
+			if record.Held {
+				fmt.Printf("Package '%s' is held at %s, run 'boom unhold %s' to install %s.\n", entry.Name, record.Version, entry.Name, entry.Version)
+				continue
+			}
+			if _, ok := record.FindRelease(entry.Version); ok {
+				fmt.Printf("Version %s of '%s' is already installed, run 'boom switch %s %s' to use it.\n", entry.Version, entry.Name, entry.Name, entry.Version)
+				continue
 			}
 		}
+
+		roots = append(roots, entry)
+		explicit[entry.Name] = true
 	}
 
-	// goto the package directory using the package name and run the executeble in the directory
-	directoryPatch := filepath.Join(currentUser.HomeDir, ".boom", "programs", package_name_property_name)
-	executablePath := filepath.Join(directoryPatch, executeble_property_name)
-	cmd := exec.Command(executablePath, os.Args[3:]...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	fmt.Println("Executing command:", cmd.String())
-	err = cmd.Run()
-	if err != nil {
-		// if error is exit status 1
-		if exitError, ok := err.(*exec.ExitError); ok {
-			// get the exit status
-			exitStatus := exitError.ExitCode()
-			// if exit status is 1
-			if exitStatus == 1 {
-				return
+	if len(roots) == 0 {
+		if promoted {
+			if err := installed.save(); err != nil {
+				fmt.Println("Error:", err)
 			}
 		}
+		return
+	}
+
+	// Work out the dependencies, which are installed first
+	plan, err := resolvePlan(index, installed, roots)
+	if err != nil {
+		fmt.Println("Error resolving dependencies:", err)
+		return
+	}
+
+	// Refuse to install next to conflicting packages unless asked to replace them
+	var names []string
+	for _, entry := range roots {
+		names = append(names, entry.Name)
+	}
+	conflicting, err := findConflicts(installed, plan, names...)
+	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
-}
+	if len(conflicting) > 0 && !args.Bool("replace") {
+		fmt.Printf("%s conflict with installed %s, use --replace to uninstall them first.\n", quoteNames(names), quoteNames(conflicting))
+		return
+	}
+	for _, name := range conflicting {
+		if record := installed.Find(name); record != nil && record.Held {
+			fmt.Printf("%s conflict with '%s', which is held and can't be replaced, run 'boom unhold %s' first.\n", quoteNames(names), name, name)
+			return
+		}
+	}
 
-func install() {
-	if len(os.Args) < 3 {
-		fmt.Println("Usage: boom install <package>")
+	// Everything below happens in one transaction: if any step fails,
+	// replaced packages come back and nothing new is left installed
+	tx, err := beginTransaction(installed)
+	if err != nil {
+		fmt.Println("Error:", err)
 		return
 	}
+	defer tx.Rollback()
 
-	// Extract the package name from the command-line arguments
-	package_name := os.Args[2]
-
-	data := getJson()
-
-	// Check if "packages" key exists in the JSON data
-	if packages, ok := data["packages"]; ok {
-		// Check if "packages" is an array
-		if packageArray, isArray := packages.([]interface{}); isArray {
-			// Iterate through the elements of the "packages" array
-			for _, pkg := range packageArray {
-				// Convert the package to a map
-				if pkgMap, isMap := pkg.(map[string]interface{}); isMap {
-					// Extract the name from the package map
-					name, _ := pkgMap["name"].(string)
-
-					// Check if the name matches the desired package
-					if name == package_name {
-						// Check if the package is already installed
-						if isInstalled(package_name) {
-							fmt.Printf("Package '%s' is already installed.\n", package_name)
-							return
-						}
-
-						// Download and install the package
-						if err := downloadAndInstallPackage(pkgMap); err != nil {
-							fmt.Println("Error installing package:", err)
-							return
-						}
-
-						// Add the package to installed.json
-						if err := addToInstalled(pkgMap); err != nil {
-							fmt.Println("Error adding package to installed.json:", err)
-							return
-						}
-
-						fmt.Printf("Package '%s' installed successfully. with '%s' \n", package_name, install_type)
-
-						//get the full path to the executable
-						executablePath := filepath.Join(currentUser.HomeDir, ".boom", "programs", package_name, executable_name)
-						directoryPath := filepath.Join(currentUser.HomeDir, ".boom", "programs", package_name)
-						zipPath := filepath.Join(currentUser.HomeDir, ".boom", "programs", package_name, installed_file_name)
-						// make a new varible for the zipped folder name
-						zipppedFolderName := strings.TrimSuffix(installed_file_name, filepath.Ext(installed_file_name))
-						zippedPath := filepath.Join(currentUser.HomeDir, ".boom", "programs", package_name, zipppedFolderName)
-
-						if install_type == "exe" {
-						} else if install_type == "setup" {
-							cmd := exec.Command("msiexec", "/i", "\""+executablePath+"\"", "/qb+", "INSTALLDIR=\""+directoryPath+"\"")
-							cmd.Stdout = os.Stdout
-							cmd.Stderr = os.Stderr
-							fmt.Println("Executing command:", cmd.String())
-							err = cmd.Run()
-							if err != nil {
-								fmt.Println("Error:", err)
-								return
-							}
-						} else if install_type == "zip" {
-							// Unzip the package
-							if err := Unzip(zipPath, directoryPath); err != nil {
-								fmt.Println("Error unzipping package:", err)
-							}
-
-							// Remove the zip file
-							if err := os.Remove(zipPath); err != nil {
-								fmt.Println("Error removing zip file:", err)
-							}
-							// move the content of the zipped folder to the directorypath
-							err = moveFileContentsToParentDir(zippedPath)
-							if err != nil {
-								fmt.Println("Error moving file contents to parent directory:", err)
-							}
-						} else {
-							fmt.Println("Unknown install type:", install_type)
-						}
-						return
-					}
-				}
-			}
+	// Download everything at once, then unpack one package at a time
+	var pkgs []*Manifest
+	for _, entry := range plan {
+		if !explicit[entry.Name] {
+			fmt.Printf("Installing dependency '%s' %s\n", entry.Name, entry.Version)
+		}
+		pkgs = append(pkgs, &entry.Manifest)
+	}
+	fileNames, err := tx.Download(pkgs, jobs)
+	if err != nil {
+		fmt.Println("Error downloading packages:", err)
+		return
+	}
+
+	// replaced packages are only removed once everything they make way for
+	// is downloaded
+	for _, name := range conflicting {
+		fmt.Printf("Replacing package '%s'\n", name)
+		if err := tx.RemovePackage(name); err != nil {
+			fmt.Printf("Error uninstalling package '%s': %s\n", name, err)
+			return
+		}
+	}
+
+	for i, entry := range plan {
+		if err := tx.Unpack(&entry.Manifest, fileNames[i], nil); err != nil {
+			fmt.Printf("Error installing package '%s': %s\n", entry.Name, err)
+			return
 		}
+		installed.Record(entry, explicit[entry.Name])
 	}
 
-	fmt.Printf("Package '%s' not found in the package repository.\n", package_name)
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	for _, entry := range roots {
+		fmt.Printf("Package '%s' %s installed successfully. with '%s' \n", entry.Name, entry.Version, entry.Install)
+	}
+}
+
+// installArtifact runs or unpacks a downloaded artifact inside directoryPath
+func installArtifact(pkg *Manifest, directoryPath, installed_file_name string) error {
+	//get the full path to the executable
+	executablePath := filepath.Join(directoryPath, pkg.Executeble)
+	archivePath := filepath.Join(directoryPath, installed_file_name)
+
+	switch pkg.Install {
+	case "exe":
+	case "setup":
+		cmd := exec.Command("msiexec", "/i", "\""+executablePath+"\"", "/qb+", "INSTALLDIR=\""+directoryPath+"\"")
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		fmt.Println("Executing command:", cmd.String())
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+	case "zip", "tar.gz", "tar.xz", "tar.bz2":
+		if err := unpackArchive(pkg, archivePath, directoryPath); err != nil {
+			return fmt.Errorf("unpacking package: %w", err)
+		}
+	case "gzip":
+		if _, err := Gunzip(archivePath, directoryPath); err != nil {
+			return fmt.Errorf("unpacking package: %w", err)
+		}
+		if err := os.Remove(archivePath); err != nil {
+			return fmt.Errorf("removing archive: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown install type '%s'", pkg.Install)
+	}
+	return nil
 }
 
 func uninstall() {
-	if len(os.Args) < 3 {
-		fmt.Println("Usage: boom uninstall <package>")
+	args := parseArgs(os.Args[2:])
+	if len(args.Positional) < 1 {
+		fmt.Println("Usage: boom uninstall <package>[@version] [--cascade] [--dry-run]")
 		return
 	}
 
 	// Extract the package name from the command-line arguments
-	package_name := os.Args[2]
+	package_name, version, oneVersion := strings.Cut(args.Arg(0), "@")
+
+	installed, err := loadInstalled()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
 
 	// Check if the package is installed
-	if !isInstalled(package_name) {
+	record := installed.Find(package_name)
+	if record == nil {
 		fmt.Printf("Package '%s' is not installed.\n", package_name)
 		return
 	}
 
+	if _, ok := record.FindRelease(version); oneVersion && !ok {
+		fmt.Printf("Version %s of '%s' is not installed.\n", version, package_name)
+		return
+	}
+
+	// package@version removes just that version, unless it's the last one
+	if oneVersion && len(record.Versions) > 1 {
+		if version == record.Version {
+			fmt.Printf("Version %s is the current version of '%s', switch to another version first.\n", version, package_name)
+			return
+		}
+		if err := os.RemoveAll(versionDir(package_name, version)); err != nil {
+			fmt.Println("Error uninstalling package:", err)
+			return
+		}
+		record.RemoveRelease(version)
+		if err := installed.save(); err != nil {
+			fmt.Println("Error removing package from installed.json:", err)
+			return
+		}
+		fmt.Printf("Version %s of '%s' uninstalled successfully.\n", version, package_name)
+		return
+	}
+
+	if users := dependents(installed, package_name); len(users) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: '%s' is needed by %s.\n", package_name, quoteNames(users))
+	}
+	orphans := newOrphans(installed, package_name)
+
+	if args.Bool("dry-run") {
+		fmt.Printf("Would uninstall '%s'.\n", package_name)
+		if args.Bool("cascade") && len(orphans) > 0 {
+			removeOrphans(orphans, true)
+		}
+		return
+	}
+
 	// Uninstall the package
 	if err := uninstallPackage(package_name); err != nil {
 		fmt.Println("Error uninstalling package:", err)
@@ -277,90 +392,75 @@ func uninstall() {
 	}
 
 	fmt.Printf("Package '%s' uninstalled successfully.\n", package_name)
-}
 
-func update() {
-	fmt.Println("update")
+	// --cascade also removes the dependencies nothing needs any more
+	if args.Bool("cascade") {
+		removeOrphans(orphans, false)
+	} else if len(orphans) > 0 {
+		fmt.Printf("%s no longer needed, run 'boom autoremove' to remove them.\n", quoteNames(orphans))
+	}
 }
 
 func list() {
-	// Path to the installed.json file
-	installedFile := currentUser.HomeDir + "/.boom/installed.json"
+	args := parseArgs(os.Args[2:])
 
-	// Open and read the JSON file
-	jsonFile, err := os.Open(installedFile)
+	installed, err := loadInstalled()
 	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
-	defer jsonFile.Close()
 
-	// Decode the JSON data into a map
-	var installedData map[string][]map[string]interface{}
-	decoder := json.NewDecoder(jsonFile)
-	if err := decoder.Decode(&installedData); err != nil {
-		fmt.Println("Error:", err)
+	if !args.Bool("bins") {
+		for _, program := range installed.Packages {
+			fmt.Println(program.Name)
+		}
 		return
 	}
 
-	// Loop through the data and print the "name" property
-	for _, programs := range installedData {
-		for _, program := range programs {
-			name, exists := program["name"].(string)
-			if exists {
-				fmt.Println(name)
-			} else {
-				fmt.Println("Name not found for program:", program)
-			}
+	// --bins lists the programs of every package and what runs them
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Name\tBin\tPath\tArgs")
+	for _, program := range installed.Packages {
+		for _, bin := range program.Bins() {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", program.Name, bin.Command(), bin.Path, strings.Join(bin.Args, " "))
 		}
 	}
+	w.Flush()
 }
 
 func search() {
-	if len(os.Args) < 3 {
-		fmt.Println("Usage: boom search <package>")
+	args := parseArgs(os.Args[2:])
+	if len(args.Positional) < 1 {
+		fmt.Println("Usage: boom search <package> [--offline]")
 		return
 	}
 
 	// Extract the search query from the command-line arguments
-	package_name := os.Args[2]
-
-	data := getJson()
-
-	// Check if "packages" key exists in the JSON data
-	if packages, ok := data["packages"]; ok {
-		// Check if "packages" is an array
-		if packageArray, isArray := packages.([]interface{}); isArray {
-			// Create a tabwriter with padding and formatting options
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-
-			// Print table headers
-			fmt.Fprintln(w, "Name\tTitle\tVersion\tAuthor\tDescription")
-
-			// Iterate through the elements of the "packages" array
-			for _, pkg := range packageArray {
-				// Convert the package to a map
-				if pkgMap, isMap := pkg.(map[string]interface{}); isMap {
-					// Extract the name from the package map
-					name, _ := pkgMap["name"].(string)
-
-					// Check if the name contains the search query as a substring
-					if strings.Contains(name, package_name) {
-						title, _ := pkgMap["title"].(string)
-						version, _ := pkgMap["version"].(string)
-						author, _ := pkgMap["author"].(string)
-						description, _ := pkgMap["description"].(string)
-
-						// Print values with tab-separated columns
-						fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name, title, version, author, description)
-					}
-				}
-			}
+	package_name := args.Arg(0)
+
+	// searching only reads metadata, so an unverified index is a warning
+	index, err := loadIndex(IndexOptions{Insecure: true, Offline: args.Bool("offline")})
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	// Create a tabwriter with padding and formatting options
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 
-			// Flush the tabwriter buffer to ensure proper formatting
-			w.Flush()
+	// Print table headers
+	fmt.Fprintln(w, "Name\tTitle\tVersion\tRegistry\tAuthor\tDescription")
+
+	for _, pkg := range index.Entries {
+		// Check if the name contains the search query as a substring
+		if strings.Contains(pkg.Name, package_name) {
+			// Print values with tab-separated columns
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", pkg.Name, pkg.Title, pkg.Version, pkg.Registry, pkg.Author, pkg.Description)
 		}
 	}
+
+	// Flush the tabwriter buffer to ensure proper formatting
+	w.Flush()
 }
 
 func version() {
@@ -380,122 +480,28 @@ func initialize() {
 		fmt.Println("Error:", err)
 	}
 
-	jsonContent := `
-{
-	"packages": []
-}
-`
+	// Create the .boom/keys trust store for registry signing keys
+	if err := os.MkdirAll(keysDir(), 0755); err != nil {
+		fmt.Println("Error:", err)
+	}
+
 	// if file does not exist, create it
-	if _, err := os.Stat(currentUser.HomeDir + "/.boom/installed.json"); os.IsNotExist(err) {
+	if _, err := os.Stat(installedPath()); os.IsNotExist(err) {
 		// Create and write to the installed.json file
-		err = os.WriteFile(currentUser.HomeDir+"/.boom/installed.json", []byte(jsonContent), 0644)
-		if err != nil {
+		empty := &InstalledDB{Schema: installedSchemaVersion, Packages: []InstalledPackage{}}
+		if err := empty.save(); err != nil {
 			fmt.Println("Error:", err)
 		}
 	}
 
-	fmt.Println(".boom directory created successfully!")
-}
-
-func getJson() map[string]interface{} {
-	// Send an HTTP GET request to the URL
-	resp, err := http.Get(url)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer resp.Body.Close()
-
-	// Check if the response status code is 200 OK
-	if resp.StatusCode != http.StatusOK {
-		log.Fatalf("HTTP request failed with status code: %d", resp.StatusCode)
-	}
-
-	// Decode the JSON response into a map
-	var data map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		log.Fatal(err)
-	}
-
-	// return data
-	return data
-}
-
-func addToInstalled(packageInfo map[string]interface{}) error {
-	// Read installed.json
-	installedFile := currentUser.HomeDir + "/.boom/installed.json"
-	installedData := make(map[string][]map[string]interface{})
-	if _, err := os.Stat(installedFile); err == nil {
-		// If the file exists, read its contents
-		jsonFile, err := os.Open(installedFile)
-		if err != nil {
-			return err
-		}
-		defer jsonFile.Close()
-
-		decoder := json.NewDecoder(jsonFile)
-		if err := decoder.Decode(&installedData); err != nil {
-			return err
-		}
-	}
-
-	// Add the package to the "packages" array
-	installedData["packages"] = append(installedData["packages"], packageInfo)
-
-	// Write the updated data back to installed.json
-	jsonContent, err := json.Marshal(installedData)
-	if err != nil {
-		return err
-	}
-
-	if err := os.WriteFile(installedFile, jsonContent, 0644); err != nil {
-		return err
-	}
-
-	// if err := prettifyInstalledJSON(); err != nil {
-	// 	fmt.Println("Error prettifying installed.json:", err)
-	// }
-
-	return nil
-}
-
-// Check if a package is already installed
-func isInstalled(packageName string) bool {
-	installedFile := currentUser.HomeDir + "/.boom/installed.json"
-
-	// Check if installed.json exists
-	if _, err := os.Stat(installedFile); err != nil {
-		// If the file doesn't exist, the package is not installed
-		return false
-	}
-
-	// Read installed.json
-	jsonFile, err := os.Open(installedFile)
-	if err != nil {
-		// Handle the error, e.g., by returning false or logging it
-		return false
-	}
-	defer jsonFile.Close()
-
-	var installedData map[string][]map[string]interface{}
-	decoder := json.NewDecoder(jsonFile)
-	if err := decoder.Decode(&installedData); err != nil {
-		// Handle the error, e.g., by returning false or logging it
-		return false
-	}
-
-	// Check if packageName is in the list of installed packages
-	packages, exists := installedData["packages"]
-	if exists {
-		for _, pkg := range packages {
-			if name, ok := pkg["name"].(string); ok && name == packageName {
-				// The package is installed
-				return true
-			}
-		}
+	// Create the .boom/shims directory for the program launchers
+	if err := os.MkdirAll(shimsDir(), 0755); err != nil {
+		fmt.Println("Error:", err)
 	}
 
-	// The package is not installed
-	return false
+	fmt.Println(".boom directory created successfully!")
+	fmt.Println("To run installed programs by name, add the shims directory to your PATH:")
+	fmt.Println("  " + pathHint())
 }
 
 type ProgressBar struct {
@@ -504,83 +510,66 @@ type ProgressBar struct {
 	Width   int
 }
 
-func downloadAndInstallPackage(packageInfo map[string]interface{}) error {
-	name, nameOk := packageInfo["name"].(string)
-	downloadURL, downloadOk := packageInfo["download"].(string)
-	installType, installTypeOk := packageInfo["install"].(string)
-	executeble, executebleOk := packageInfo["executeble"].(string)
-
-	if !nameOk || !downloadOk || !installTypeOk || !executebleOk {
-		return fmt.Errorf("invalid package information")
+// downloadPackage downloads the package artifact into packageDir and
+// returns the downloaded file name
+func downloadPackage(pkg *Manifest, packageDir string, line *progressLine) (string, error) {
+	if err := pkg.Validate(); err != nil {
+		return "", err
 	}
 
-	// Create a directory for the package in .boom/programs
-	packageDir := fmt.Sprintf("%s/.boom/programs/%s", currentUser.HomeDir, name)
+	// Create the directory for the package
 	if err := os.MkdirAll(packageDir, 0755); err != nil {
-		return err
+		return "", err
 	}
 
 	// Extract the original file name from the URL
-	urlParts := strings.Split(downloadURL, "/")
+	urlParts := strings.Split(pkg.Download, "/")
 	originalFileName := urlParts[len(urlParts)-1]
+	if path, ok := localPath(pkg.Download); ok {
+		originalFileName = filepath.Base(path)
+	}
 
 	// Create the full path to the executable using the original file name
 	executablePath := filepath.Join(packageDir, originalFileName)
 
-	// Download the package from the provided URL
-	response, err := http.Get(downloadURL)
-	if err != nil {
-		return err
-	}
-	defer response.Body.Close()
-	// get the package donwload name
-	installed_file_name = originalFileName
-	// Create a new file to save the downloaded package
-	file, err := os.Create(executablePath)
-	if err != nil {
-		return err
+	// Parse the expected checksum before writing anything to disk
+	var checksum *Checksum
+	if pkg.Hash != "" {
+		var err error
+		checksum, err = parseChecksum(pkg.Hash)
+		if err != nil {
+			return "", err
+		}
 	}
-	defer file.Close()
-
-	// Get the content length for the progress bar
-	contentLength := response.ContentLength
 
-	// Create a progress bar
-	bar := progressbar.NewOptions64(
-		contentLength,
-		progressbar.OptionSetRenderBlankState(true),
-		progressbar.OptionSetWidth(30),
-		progressbar.OptionSetDescription("Downloading"),
-	)
-
-	// Create a proxy reader to track the download progress
-	customReader := &CustomProgressBarReader{reader: &progressbar.Reader{}}
-	*customReader.reader = progressbar.NewReader(response.Body, bar)
+	// Download the package from the provided URL or local file
+	if err := download(pkg.Download, executablePath, checksum, line); err != nil {
+		os.Remove(packageDir)
+		return "", fmt.Errorf("downloading %s: %w", originalFileName, err)
+	}
 
-	// Copy the downloaded data to the file with progress tracking
-	_, err = io.Copy(file, customReader)
-	if err != nil {
-		return err
+	// Without an install type in the manifest, look at the file itself
+	if pkg.Install == "" {
+		installType, err := detectInstallType(executablePath)
+		if err != nil {
+			return "", err
+		}
+		pkg.Install = installType
 	}
 
 	// Make the executable file executable (e.g., for .exe files on Windows)
-	if installType == "exe" {
+	if pkg.Install == "exe" {
 		if err := os.Chmod(executablePath, 0755); err != nil {
-			return err
+			return "", err
 		}
 	}
 
-	install_type = installType
-	executable_name = executeble
-	return nil
+	return originalFileName, nil
 }
 
 func uninstallPackage(packageName string) error {
-	// Create the full path to the package directory
-	packageDir := fmt.Sprintf("%s/.boom/programs/%s", currentUser.HomeDir, packageName)
-
-	// Remove the package directory
-	if err := os.RemoveAll(packageDir); err != nil {
+	// Remove the package directory with every installed version
+	if err := os.RemoveAll(programDir(packageName)); err != nil {
 		return err
 	}
 
@@ -588,184 +577,54 @@ func uninstallPackage(packageName string) error {
 }
 
 func removefromInstalled(packageName string) error {
-	installedFile := currentUser.HomeDir + "/.boom/installed.json"
-
-	// Check if installed.json exists
-	if _, err := os.Stat(installedFile); err != nil {
-		// If the file doesn't exist, the package is not installed
-		return nil
-	}
-
-	// Read installed.json
-	jsonFile, err := os.Open(installedFile)
+	installed, err := loadInstalled()
 	if err != nil {
 		return err
 	}
-	defer jsonFile.Close()
-
-	var installedData map[string][]map[string]interface{}
-	decoder := json.NewDecoder(jsonFile)
-	if err := decoder.Decode(&installedData); err != nil {
-		return err
-	}
-
-	// Check if packageName is in the list of installed packages then remove it
-	packages, exists := installedData["packages"]
-	if exists {
-		for i, pkg := range packages {
-			if name, ok := pkg["name"].(string); ok && name == packageName {
-				// Remove the package from the list of installed packages
-				installedData["packages"] = append(packages[:i], packages[i+1:]...)
-
-				// Write the updated data back to installed.json
-				jsonContent, err := json.Marshal(installedData)
-				if err != nil {
-					return err
-				}
-
-				if err := os.WriteFile(installedFile, jsonContent, 0644); err != nil {
-					return err
-				}
-
-			}
-		}
-	}
 
-	if err := prettifyInstalledJSON(); err != nil {
-		fmt.Println("Error prettifying installed.json:", err)
+	// Remove the package from the list of installed packages
+	if !installed.Remove(packageName) {
+		return nil
 	}
 
-	return nil
+	// Write the updated data back to installed.json
+	return installed.save()
 }
 
-func prettifyInstalledJSON() error {
-	installedFile := currentUser.HomeDir + "/.boom/installed.json"
-
-	// Read installed.json
-	jsonFile, err := os.Open(installedFile)
-	if err != nil {
-		return err
-	}
-	defer jsonFile.Close()
-
-	var installedData map[string]interface{}
-	decoder := json.NewDecoder(jsonFile)
-	if err := decoder.Decode(&installedData); err != nil {
-		return err
-	}
-
-	// Prettify the JSON data
-	prettifiedJSON, err := json.MarshalIndent(installedData, "", "    ")
-	if err != nil {
-		return err
-	}
-
-	// Write the prettified data back to installed.json
-	if err := os.WriteFile(installedFile, prettifiedJSON, 0644); err != nil {
+// mergeDir moves everything in sourceDir into destDir, replacing files that
+// already exist there and keeping the ones that don't
+func mergeDir(sourceDir, destDir string) error {
+	if err := os.MkdirAll(destDir, 0755); err != nil {
 		return err
 	}
 
-	fmt.Println("installed.json prettified successfully.")
-	return nil
-}
-
-// CustomProgressBarReader wraps progressbar.Reader and implements io.Reader
-type CustomProgressBarReader struct {
-	reader *progressbar.Reader
-}
-
-func (cpr *CustomProgressBarReader) Read(p []byte) (n int, err error) {
-	return cpr.reader.Read(p)
-}
-
-func Unzip(src, dest string) error {
-	r, err := zip.OpenReader(src)
+	entries, err := os.ReadDir(sourceDir)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if err := r.Close(); err != nil {
-			panic(err)
-		}
-	}()
-
-	os.MkdirAll(dest, 0755)
-
-	// Closure to address file descriptors issue with all the deferred .Close() methods
-	extractAndWriteFile := func(f *zip.File) error {
-		rc, err := f.Open()
-		if err != nil {
-			return err
-		}
-		defer func() {
-			if err := rc.Close(); err != nil {
-				panic(err)
-			}
-		}()
 
-		path := filepath.Join(dest, f.Name)
+	for _, entry := range entries {
+		source := filepath.Join(sourceDir, entry.Name())
+		dest := filepath.Join(destDir, entry.Name())
 
-		// Check for ZipSlip (Directory traversal)
-		if !strings.HasPrefix(path, filepath.Clean(dest)+string(os.PathSeparator)) {
-			return fmt.Errorf("illegal file path: %s", path)
-		}
-
-		if f.FileInfo().IsDir() {
-			os.MkdirAll(path, f.Mode())
-		} else {
-			os.MkdirAll(filepath.Dir(path), f.Mode())
-			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-			if err != nil {
+		// a link in destDir is replaced, never merged into
+		if info, err := os.Lstat(dest); err == nil && info.IsDir() && entry.IsDir() {
+			if err := mergeDir(source, dest); err != nil {
 				return err
 			}
-			defer func() {
-				if err := f.Close(); err != nil {
-					panic(err)
-				}
-			}()
-
-			_, err = io.Copy(f, rc)
-			if err != nil {
+			continue
+		} else if err == nil {
+			// a file replaced by a directory or the other way around
+			if err := os.RemoveAll(dest); err != nil {
 				return err
 			}
 		}
-		return nil
-	}
-
-	for _, f := range r.File {
-		err := extractAndWriteFile(f)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-func moveFileContentsToParentDir(sourceDir string) error {
-	// get the parent directory
-	parentDir := filepath.Dir(sourceDir)
-
-	// get the files in the source directory
-	files, err := ioutil.ReadDir(sourceDir)
-	if err != nil {
-		return err
-	}
 
-	// move the files to the parent directory
-	for _, file := range files {
-		err := os.Rename(filepath.Join(sourceDir, file.Name()), filepath.Join(parentDir, file.Name()))
-		if err != nil {
+		if err := os.Rename(source, dest); err != nil {
 			return err
 		}
 	}
 
-	// remove the source directory
-	err = os.Remove(sourceDir)
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// downloadCacheMeta is stored next to a cached download as <key>.meta.json
+type downloadCacheMeta struct {
+	URL          string    `json:"url"`
+	DownloadedAt time.Time `json:"downloaded_at,omitempty"`
+	// Validator is the ETag or Last-Modified value an unfinished .part
+	// download was fetched with
+	Validator string `json:"validator,omitempty"`
+}
+
+// CachedDownload is one artifact in ~/.boom/cache/downloads
+type CachedDownload struct {
+	Key      string
+	Path     string
+	URL      string
+	Size     int64
+	LastUsed time.Time
+}
+
+// cachedDownloadPath is where the artifact with the given checksum is kept.
+// The cache is keyed by content, so packages and versions that ship the same
+// file share one entry.
+func cachedDownloadPath(checksum *Checksum) string {
+	return filepath.Join(downloadsDir(), checksum.Algorithm+"-"+hex.EncodeToString(checksum.Digest))
+}
+
+// useCachedDownload copies a cached artifact to dest if there is one that
+// still matches checksum. A damaged entry is dropped so it is downloaded
+// again.
+func useCachedDownload(checksum *Checksum, dest string, line *progressLine) (bool, error) {
+	cached := cachedDownloadPath(checksum)
+	if _, err := os.Stat(cached); err != nil {
+		return false, nil
+	}
+	if err := verifyFile(cached, checksum); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: dropping damaged cache entry %s: %s\n", filepath.Base(cached), err)
+		removeCachedDownload(cached)
+		return false, nil
+	}
+
+	line.Set("using cached %s", filepath.Base(dest))
+	if err := copyFile(cached, dest, 0644); err != nil {
+		return false, err
+	}
+
+	// the modification time records the last use, for `boom cache clean`
+	now := time.Now()
+	os.Chtimes(cached, now, now)
+	return true, nil
+}
+
+// storeDownload moves a complete, verified download into the cache and
+// copies it to dest
+func storeDownload(part, source string, checksum *Checksum, dest string) error {
+	cached := cachedDownloadPath(checksum)
+	if err := os.Rename(part, cached); err != nil {
+		return err
+	}
+
+	metaContent, err := json.MarshalIndent(downloadCacheMeta{URL: source, DownloadedAt: time.Now()}, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(cached+".meta.json", metaContent, 0644); err != nil {
+		return err
+	}
+	return copyFile(cached, dest, 0644)
+}
+
+func removeCachedDownload(path string) error {
+	os.Remove(path + ".meta.json")
+	return os.Remove(path)
+}
+
+// cachedDownloads lists the download cache, most recently used first.
+// Unfinished .part downloads are included too.
+func cachedDownloads() ([]CachedDownload, error) {
+	files, err := os.ReadDir(downloadsDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var downloads []CachedDownload
+	for _, file := range files {
+		if file.IsDir() || strings.HasSuffix(file.Name(), ".meta.json") {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			return nil, err
+		}
+		download := CachedDownload{
+			Key:      file.Name(),
+			Path:     filepath.Join(downloadsDir(), file.Name()),
+			Size:     info.Size(),
+			LastUsed: info.ModTime(),
+		}
+		if data, err := os.ReadFile(download.Path + ".meta.json"); err == nil {
+			var meta downloadCacheMeta
+			if json.Unmarshal(data, &meta) == nil {
+				download.URL = meta.URL
+			}
+		}
+		downloads = append(downloads, download)
+	}
+
+	sort.Slice(downloads, func(i, j int) bool {
+		return downloads[i].LastUsed.After(downloads[j].LastUsed)
+	})
+	return downloads, nil
+}
+
+func cacheCommand() {
+	args := parseArgs(os.Args[2:], "older-than")
+
+	downloads, err := cachedDownloads()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	switch args.Arg(0) {
+	case "list":
+		if len(downloads) == 0 {
+			fmt.Println("The download cache is empty.")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "File\tSize\tLast Used\tHash")
+		for _, download := range downloads {
+			name, key := filepath.Base(download.URL), download.Key
+			if strings.HasSuffix(key, ".part") {
+				name, key = "(partial download)", ""
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, formatSize(download.Size), download.LastUsed.Format("2006-01-02 15:04"), key)
+		}
+		w.Flush()
+	case "size":
+		var total int64
+		for _, download := range downloads {
+			total += download.Size
+		}
+		fmt.Printf("%s in %d files (%s)\n", formatSize(total), len(downloads), downloadsDir())
+	case "clean":
+		// without --older-than everything goes
+		cutoff := time.Now()
+		if spec := args.String("older-than", ""); spec != "" {
+			age, err := parseAge(spec)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			cutoff = cutoff.Add(-age)
+		}
+
+		var removed int
+		var freed int64
+		for _, download := range downloads {
+			if download.LastUsed.After(cutoff) {
+				continue
+			}
+			if err := removeCachedDownload(download.Path); err != nil {
+				fmt.Println("Error:", err)
+				continue
+			}
+			removed++
+			freed += download.Size
+		}
+		fmt.Printf("Removed %d files, freed %s.\n", removed, formatSize(freed))
+	default:
+		fmt.Println("Usage: boom cache <list|size|clean [--older-than <age>]>")
+	}
+}
+
+// parseAge parses a Go duration, with "d" accepted for days: "30d", "12h"
+func parseAge(spec string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(spec, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age '%s'", spec)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(spec)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age '%s', use something like 30d or 12h", spec)
+	}
+	return age, nil
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, exp := float64(size)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "KMGT"[exp])
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// Checksum is a parsed manifest "hash" field of the form "<algorithm>:<hex digest>"
+type Checksum struct {
+	Algorithm string
+	Digest    []byte
+}
+
+// checksumAlgorithms maps every supported algorithm to its constructor
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// parseChecksum parses a string like "sha256:9f86d08..."
+func parseChecksum(s string) (*Checksum, error) {
+	algorithm, digest, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, fmt.Errorf("expected '<algorithm>:<hex digest>', got '%s'", s)
+	}
+	algorithm = strings.ToLower(algorithm)
+
+	newHash, ok := checksumAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash algorithm '%s' (use sha256 or sha512)", algorithm)
+	}
+
+	sum, err := hex.DecodeString(digest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex digest: %w", err)
+	}
+	if len(sum) != newHash().Size() {
+		return nil, fmt.Errorf("%s digest must be %d hex characters, got %d", algorithm, newHash().Size()*2, len(digest))
+	}
+
+	return &Checksum{Algorithm: algorithm, Digest: sum}, nil
+}
+
+// New returns a hash.Hash for the checksum's algorithm
+func (c *Checksum) New() hash.Hash {
+	return checksumAlgorithms[c.Algorithm]()
+}
+
+func (c *Checksum) String() string {
+	return c.Algorithm + ":" + hex.EncodeToString(c.Digest)
+}
+
+// Verify compares the digest accumulated in h against the expected digest
+func (c *Checksum) Verify(h hash.Hash) error {
+	actual := h.Sum(nil)
+	if !bytes.Equal(actual, c.Digest) {
+		return &ChecksumError{
+			Expected: c.String(),
+			Actual:   c.Algorithm + ":" + hex.EncodeToString(actual),
+		}
+	}
+	return nil
+}
+
+// ChecksumError reports a downloaded artifact that doesn't match its manifest hash
+type ChecksumError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch: expected %s, got %s", e.Expected, e.Actual)
+}
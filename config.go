@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// defaultRegistryURL is the public BOOM registry
+const defaultRegistryURL = "https://raw.githubusercontent.com/jooapa/BOOM/main/db.json"
+
+// Config is the decoded form of ~/.boom/config.json
+type Config struct {
+	// Registries in priority order, the first one wins when several
+	// registries have a package with the same name
+	Registries []RegistryConfig `json:"registries"`
+
+	// IndexTTL is how long a cached remote index is used before it is
+	// revalidated, as a Go duration such as "30m". Defaults to one hour.
+	IndexTTL string `json:"index_ttl,omitempty"`
+
+	// DownloadRetries is how often a failed download is retried. Defaults
+	// to 3.
+	DownloadRetries *int `json:"download_retries,omitempty"`
+
+	// DownloadTimeout is how long a download may wait for the server
+	// before the attempt fails, as a Go duration. Defaults to 30s.
+	DownloadTimeout string `json:"download_timeout,omitempty"`
+
+	// DownloadJobs is how many downloads `boom install` runs at the same
+	// time. Defaults to 4.
+	DownloadJobs int `json:"download_jobs,omitempty"`
+
+	// RequireHash refuses to download packages whose manifest has no hash.
+	// Defaults to true; false installs them with a warning.
+	RequireHash *bool `json:"require_hash,omitempty"`
+
+	// ExtractMaxSize is the most bytes one archive may unpack to. Defaults
+	// to 8 GiB.
+	ExtractMaxSize int64 `json:"extract_max_size,omitempty"`
+
+	// ExtractMaxFiles is the most entries one archive may have. Defaults to
+	// 200000.
+	ExtractMaxFiles int `json:"extract_max_files,omitempty"`
+}
+
+// RegistryConfig is a named package index source
+type RegistryConfig struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+func configPath() string {
+	return filepath.Join(currentUser.HomeDir, ".boom", "config.json")
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Registries: []RegistryConfig{{Name: "main", URL: defaultRegistryURL}},
+	}
+}
+
+// loadConfig reads config.json, falling back to the defaults when it doesn't exist
+func loadConfig() (*Config, error) {
+	config := defaultConfig()
+
+	data, err := os.ReadFile(configPath())
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("decoding config.json: %w", err)
+	}
+	return config, nil
+}
+
+// save writes the configuration back to config.json
+func (c *Config) save() error {
+	jsonContent, err := json.MarshalIndent(c, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(configPath(), jsonContent, 0644)
+}
+
+// Registry returns the registry with the given name
+func (c *Config) Registry(name string) (*RegistryConfig, bool) {
+	for i := range c.Registries {
+		if c.Registries[i].Name == name {
+			return &c.Registries[i], true
+		}
+	}
+	return nil, false
+}
+
+// requireHash tells whether packages without a hash are refused
+func (c *Config) requireHash() bool {
+	return c.RequireHash == nil || *c.RequireHash
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Dependency is a parsed "depends" entry: "[registry/]name[@constraint]"
+type Dependency struct {
+	Ref        string // name or registry/name, as accepted by MergedIndex.Find
+	Name       string
+	Constraint *Constraint
+}
+
+func parseDependency(dep string) (*Dependency, error) {
+	ref, spec, _ := strings.Cut(strings.TrimSpace(dep), "@")
+	_, name, hasRegistry := strings.Cut(ref, "/")
+	if !hasRegistry {
+		name = ref
+	}
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid dependency '%s'", dep)
+	}
+
+	constraint, err := parseConstraint(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &Dependency{Ref: ref, Name: name, Constraint: constraint}, nil
+}
+
+func (d *Dependency) String() string {
+	if d.Constraint.Any() {
+		return d.Name
+	}
+	return d.Name + "@" + d.Constraint.String()
+}
+
+// resolver works out which packages an install needs, in the order they
+// must be installed
+type resolver struct {
+	index     *MergedIndex
+	installed *InstalledDB
+
+	chosen   map[string]*IndexEntry // packages picked for installation
+	picked   []*IndexEntry          // the same, in the order they were picked
+	neededBy map[string]string      // who asked for each chosen package
+	visiting []string               // the current dependency path, for cycle detection
+	done     map[string]bool        // chosen packages already in order
+	order    []*IndexEntry
+}
+
+// resolveDependencies returns every package root needs that isn't installed
+// yet, dependencies before the packages that need them. Already installed
+// packages must satisfy the constraints on them; they are never changed.
+//
+// The first matching version wins: if two packages constrain the same
+// dependency differently, the resolver reports the conflict rather than
+// searching for a version that satisfies both.
+func resolveDependencies(index *MergedIndex, installed *InstalledDB, root *IndexEntry) ([]*IndexEntry, error) {
+	plan, err := resolvePlan(index, installed, []*IndexEntry{root})
+	if err != nil {
+		return nil, err
+	}
+
+	// the root itself is installed (or replaced) by the caller
+	return plan[:len(plan)-1], nil
+}
+
+// resolvePlan returns the packages to install for several requested ones,
+// the roots included, dependencies before the packages that need them
+func resolvePlan(index *MergedIndex, installed *InstalledDB, roots []*IndexEntry) ([]*IndexEntry, error) {
+	r := &resolver{
+		index:     index,
+		installed: installed,
+		chosen:    make(map[string]*IndexEntry),
+		neededBy:  make(map[string]string),
+		done:      make(map[string]bool),
+	}
+	for _, root := range roots {
+		if chosen, ok := r.chosen[root.Name]; ok {
+			if chosen.Version != root.Version {
+				return nil, fmt.Errorf("'%s' was requested as both %s and %s", root.Name, chosen.Version, root.Version)
+			}
+			continue
+		}
+		r.chosen[root.Name] = root
+		r.picked = append(r.picked, root)
+		r.neededBy[root.Name] = "the install request"
+	}
+
+	for _, root := range r.picked {
+		if !r.done[root.Name] {
+			if err := r.visit(root); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return r.order, nil
+}
+
+func (r *resolver) visit(entry *IndexEntry) error {
+	r.visiting = append(r.visiting, entry.Name)
+	defer func() { r.visiting = r.visiting[:len(r.visiting)-1] }()
+
+	for _, dep := range entry.Depends {
+		if err := r.require(entry, dep); err != nil {
+			return err
+		}
+	}
+
+	r.order = append(r.order, entry)
+	r.done[entry.Name] = true
+	return nil
+}
+
+// require makes sure the dependency dep of entry will be satisfied
+func (r *resolver) require(entry *IndexEntry, dep string) error {
+	d, err := parseDependency(dep)
+	if err != nil {
+		return fmt.Errorf("package '%s': %w", entry.Name, err)
+	}
+
+	// a package on the current dependency path needs itself
+	for i, name := range r.visiting {
+		if name == d.Name {
+			cycle := append(append([]string{}, r.visiting[i:]...), d.Name)
+			return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	if chosen, ok := r.chosen[d.Name]; ok {
+		if !d.Constraint.Match(chosen.Version) {
+			return fmt.Errorf("'%s' needs %s, but %s@%s was already picked for %s",
+				entry.Name, d, d.Name, chosen.Version, r.neededBy[d.Name])
+		}
+		// another requested package that hasn't been visited yet
+		if !r.done[d.Name] {
+			return r.visit(chosen)
+		}
+		return nil
+	}
+
+	if record := r.installed.Find(d.Name); record != nil {
+		if !d.Constraint.Match(record.Version) {
+			return fmt.Errorf("'%s' needs %s, but version %s is installed, update or switch it first", entry.Name, d, record.Version)
+		}
+		return nil
+	}
+
+	// virtual names are satisfied by any package that provides them;
+	// version constraints only apply to real package names
+	for _, chosen := range r.picked {
+		if chosen.ProvidesName(chosen.Name, d.Name) {
+			if !r.done[chosen.Name] && !slices.Contains(r.visiting, chosen.Name) {
+				return r.visit(chosen)
+			}
+			return nil
+		}
+	}
+	if len(r.installed.Providers(d.Name)) > 0 {
+		return nil
+	}
+
+	candidate, ok := r.index.Find(d.Ref)
+	if !ok {
+		candidate, ok = r.index.FindProvider(d.Name)
+	}
+	if !ok {
+		return fmt.Errorf("'%s' needs %s, which isn't in any registry%s", entry.Name, d, r.index.skippedNote())
+	}
+	if err := r.index.checkShadowed(d.Ref, candidate); err != nil {
+		return fmt.Errorf("'%s' needs %s: %w", entry.Name, d, err)
+	}
+	spec := d.Constraint.String()
+	if candidate.Name != d.Name {
+		spec = "latest"
+	}
+	resolved, err := candidate.Resolve(spec)
+	if err != nil {
+		return fmt.Errorf("'%s' needs %s: %w", entry.Name, d, err)
+	}
+
+	r.chosen[resolved.Name] = resolved
+	r.picked = append(r.picked, resolved)
+	r.neededBy[resolved.Name] = "'" + entry.Name + "'"
+	return r.visit(resolved)
+}
+
+// conflictsWith reports whether release a of package aName declares a
+// conflict with package b at its current version, by name or through a
+// virtual name b provides
+func conflictsWith(aName string, a *Release, bName string, b *Release) bool {
+	if aName == bName {
+		return false
+	}
+	for _, conflict := range a.Conflicts {
+		d, err := parseDependency(conflict)
+		if err != nil {
+			continue
+		}
+		if d.Name == bName && d.Constraint.Match(b.Version) {
+			return true
+		}
+		if d.Name != bName && b.ProvidesName(bName, d.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// findConflicts checks the packages about to be installed against each other
+// and against what is installed. Conflicts inside the plan are errors; the
+// installed packages that conflict are returned so the caller can refuse or
+// replace them. Records named in skip are ignored, for packages the plan is
+// about to update.
+func findConflicts(installed *InstalledDB, plan []*IndexEntry, skip ...string) ([]string, error) {
+	for i, a := range plan {
+		for _, b := range plan[i+1:] {
+			if conflictsWith(a.Name, &a.Release, b.Name, &b.Release) || conflictsWith(b.Name, &b.Release, a.Name, &a.Release) {
+				return nil, fmt.Errorf("'%s' and '%s' conflict and can't be installed together", a.Name, b.Name)
+			}
+		}
+	}
+
+	var conflicting []string
+	for i := range installed.Packages {
+		record := &installed.Packages[i]
+		if slices.Contains(skip, record.Name) {
+			continue
+		}
+		for _, entry := range plan {
+			if entry.Name == record.Name {
+				continue
+			}
+			if conflictsWith(entry.Name, &entry.Release, record.Name, &record.Release) || conflictsWith(record.Name, &record.Release, entry.Name, &entry.Release) {
+				conflicting = append(conflicting, record.Name)
+				break
+			}
+		}
+	}
+	return conflicting, nil
+}
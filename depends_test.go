@@ -0,0 +1,191 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testPackage is a package in the test index with one release per version,
+// each depending on depends
+func testPackage(name string, versions []string, depends ...string) IndexEntry {
+	manifest := Manifest{Name: name}
+	for _, version := range versions {
+		manifest.Versions = append(manifest.Versions, Release{Version: version, Install: "exe", Executeble: name + ".exe", Depends: depends})
+	}
+	manifest.normalize()
+	return IndexEntry{Manifest: manifest, Registry: "main"}
+}
+
+func testIndex(entries ...IndexEntry) *MergedIndex {
+	return &MergedIndex{Entries: entries, Registries: []string{"main"}}
+}
+
+// testInstalled is an installed package at version, explicit or installed
+// as a dependency
+func testInstalled(name, version string, explicit bool, depends ...string) InstalledPackage {
+	reason := reasonDependency
+	if explicit {
+		reason = reasonExplicit
+	}
+	release := Release{Version: version, Depends: depends}
+	return InstalledPackage{
+		Manifest: Manifest{Name: name, Release: release, Versions: []Release{release}},
+		Reason:   reason,
+	}
+}
+
+func TestResolvePlan(t *testing.T) {
+	virtual := testPackage("speedcrunch", []string{"0.12"})
+	virtual.Provides = []string{"calculator"}
+
+	index := testIndex(
+		testPackage("app", []string{"1.0"}, "lib@^1.2", "tool"),
+		testPackage("lib", []string{"1.1", "1.2.5", "1.9", "2.0"}, "base"),
+		testPackage("tool", []string{"1.0"}, "base@>=1.0"),
+		testPackage("base", []string{"1.0", "1.1-rc.1"}),
+		testPackage("old", []string{"1.0"}, "lib@<1.2"),
+		testPackage("both", []string{"1.0"}, "app", "old"),
+		testPackage("math", []string{"1.0"}, "calculator"),
+		virtual,
+		testPackage("loop-a", []string{"1.0"}, "loop-b"),
+		testPackage("loop-b", []string{"1.0"}, "loop-c"),
+		testPackage("loop-c", []string{"1.0"}, "loop-a"),
+		testPackage("broken", []string{"1.0"}, "missing"),
+		testPackage("picky", []string{"1.0"}, "base@^3"),
+	)
+
+	tests := []struct {
+		name      string
+		roots     []string
+		installed []InstalledPackage
+		want      string // the plan as name@version, or part of the error
+	}{
+		{"dependencies first", []string{"app"}, nil, "base@1.0 lib@1.9 tool@1.0 app@1.0"},
+		{"installed dependency", []string{"app"}, []InstalledPackage{testInstalled("base", "1.0", false)}, "lib@1.9 tool@1.0 app@1.0"},
+		{"installed dependency too old", []string{"tool"}, []InstalledPackage{testInstalled("base", "0.9", false)}, "but version 0.9 is installed"},
+		{"several roots", []string{"tool", "base"}, nil, "base@1.0 tool@1.0"},
+		{"virtual provider", []string{"math"}, nil, "speedcrunch@0.12 math@1.0"},
+		{"installed provider", []string{"math"}, []InstalledPackage{{Manifest: virtual.Manifest}}, "math@1.0"},
+		{"cycle", []string{"loop-a"}, nil, "dependency cycle: loop-a -> loop-b -> loop-c -> loop-a"},
+		{"missing dependency", []string{"broken"}, nil, "isn't in any registry"},
+		{"no matching version", []string{"picky"}, nil, "no version of 'base' matches '^3'"},
+		{"conflicting constraints", []string{"both"}, nil, "already picked for"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var roots []*IndexEntry
+			for _, name := range test.roots {
+				entry, ok := index.Find(name)
+				if !ok {
+					t.Fatalf("%s is not in the test index", name)
+				}
+				roots = append(roots, entry)
+			}
+
+			plan, err := resolvePlan(index, &InstalledDB{Packages: test.installed}, roots)
+			var got string
+			if err != nil {
+				got = err.Error()
+			} else {
+				var names []string
+				for _, entry := range plan {
+					names = append(names, entry.Name+"@"+entry.Version)
+				}
+				got = strings.Join(names, " ")
+			}
+			if !strings.Contains(got, test.want) || (err == nil && got != test.want) {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFindConflicts(t *testing.T) {
+	fork := testPackage("fork", []string{"1.0"})
+	fork.Conflicts = []string{"calc@<2.0"}
+	calc := testInstalled("calc", "1.5", true)
+	newCalc := testInstalled("calc", "2.0", true)
+
+	conflicting, err := findConflicts(&InstalledDB{Packages: []InstalledPackage{calc}}, []*IndexEntry{&fork})
+	if err != nil || !slices.Equal(conflicting, []string{"calc"}) {
+		t.Errorf("got %q, %v, want calc to conflict", conflicting, err)
+	}
+	conflicting, err = findConflicts(&InstalledDB{Packages: []InstalledPackage{newCalc}}, []*IndexEntry{&fork})
+	if err != nil || len(conflicting) != 0 {
+		t.Errorf("got %q, %v, want calc 2.0 to be allowed", conflicting, err)
+	}
+	// the record being updated doesn't count
+	conflicting, err = findConflicts(&InstalledDB{Packages: []InstalledPackage{calc}}, []*IndexEntry{&fork}, "calc")
+	if err != nil || len(conflicting) != 0 {
+		t.Errorf("got %q, %v, want skipped records to be ignored", conflicting, err)
+	}
+
+	calcEntry := testPackage("calc", []string{"1.5"})
+	if _, err := findConflicts(&InstalledDB{}, []*IndexEntry{&calcEntry, &fork}); err == nil {
+		t.Error("conflicting packages were planned together")
+	}
+}
+
+func TestFindOrphans(t *testing.T) {
+	provider := testInstalled("speedcrunch", "0.12", false)
+	provider.Provides = []string{"calculator"}
+
+	tests := []struct {
+		name      string
+		installed []InstalledPackage
+		want      []string
+	}{
+		{"nothing installed", nil, nil},
+		{"needed dependencies", []InstalledPackage{
+			testInstalled("app", "1.0", true, "lib@^1"),
+			testInstalled("lib", "1.2", false, "base"),
+			testInstalled("base", "1.0", false),
+		}, nil},
+		{"unneeded dependencies", []InstalledPackage{
+			testInstalled("app", "1.0", true),
+			testInstalled("lib", "1.2", false, "base"),
+			testInstalled("base", "1.0", false),
+		}, []string{"base", "lib"}},
+		{"virtual provider", []InstalledPackage{
+			testInstalled("math", "1.0", true, "calculator"),
+			provider,
+		}, nil},
+		{"dependency cycle", []InstalledPackage{
+			testInstalled("a", "1.0", false, "b"),
+			testInstalled("b", "1.0", false, "a"),
+		}, []string{"a", "b"}},
+		// records from before reasons were stored count as explicit
+		{"no reason", []InstalledPackage{
+			{Manifest: Manifest{Name: "legacy"}},
+		}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := findOrphans(&InstalledDB{Packages: test.installed})
+			if !slices.Equal(got, test.want) {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewOrphans(t *testing.T) {
+	db := &InstalledDB{Packages: []InstalledPackage{
+		testInstalled("app", "1.0", true, "lib"),
+		testInstalled("other", "1.0", true, "base"),
+		testInstalled("lib", "1.2", false, "base"),
+		testInstalled("base", "1.0", false),
+		testInstalled("stale", "1.0", false),
+	}}
+
+	// base is still needed by other, and stale was an orphan already
+	if got := newOrphans(db, "app"); !slices.Equal(got, []string{"lib"}) {
+		t.Errorf("removing app orphans %q, want lib", got)
+	}
+	if got := newOrphans(db, "other"); len(got) != 0 {
+		t.Errorf("removing other orphans %q, want nothing", got)
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDownloadRetries = 3
+	defaultDownloadTimeout = 30 * time.Second
+	defaultDownloadJobs    = 4
+)
+
+// retryDelay is how long the first retry of a download waits; each further
+// retry waits twice as long
+var retryDelay = time.Second
+
+// transientError marks a download failure that is worth retrying, such as a
+// dropped connection or a 503 from the server
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+func isTransient(err error) bool {
+	var transient *transientError
+	return errors.As(err, &transient)
+}
+
+func downloadsDir() string {
+	return filepath.Join(currentUser.HomeDir, ".boom", "cache", "downloads")
+}
+
+// partPath is where an interrupted download of source is kept until it is
+// resumed
+func partPath(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return filepath.Join(downloadsDir(), hex.EncodeToString(sum[:])+".part")
+}
+
+// download fetches source into dest and verifies it against checksum, which
+// may be nil. Remote artifacts with a checksum come from the download cache
+// when it has them and are added to it otherwise. Remote downloads go to a
+// .part file first: transient errors are retried with exponential backoff,
+// resuming where the previous attempt stopped when the server supports Range
+// requests, and a download that still fails is resumed by the next run.
+func download(source, dest string, checksum *Checksum, line *progressLine) error {
+	if _, ok := localPath(source); ok {
+		if err := copySource(source, dest, checksum, line); err != nil {
+			return err
+		}
+		line.Set("copied %s", filepath.Base(dest))
+		return nil
+	}
+
+	// artifacts with a hash are kept in the cache and reused
+	if checksum != nil {
+		if ok, err := useCachedDownload(checksum, dest, line); ok || err != nil {
+			return err
+		}
+	}
+
+	retries, timeout, err := downloadSettings()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(downloadsDir(), 0755); err != nil {
+		return err
+	}
+
+	part := partPath(source)
+	validator := readPartValidator(part)
+	for attempt := 0; ; attempt++ {
+		// without a validator, nothing tells whether the data so far is
+		// from the file the server has now, and without a hash a file
+		// spliced from two versions would go unnoticed
+		if validator == "" && checksum == nil {
+			removeCachedDownload(part)
+		}
+		err := fetchPart(source, part, timeout, &validator, line)
+		if err == nil {
+			break
+		}
+		if !isTransient(err) || attempt >= retries {
+			// keep what was downloaded for the next run
+			if info, statErr := os.Stat(part); statErr == nil && info.Size() == 0 {
+				removeCachedDownload(part)
+			}
+			return err
+		}
+		delay := retryDelay << attempt
+		line.Set("%s, retrying in %s (%d/%d)", err, delay, attempt+1, retries)
+		time.Sleep(delay)
+	}
+
+	// a resumed download was written in several pieces, so it is hashed
+	// once it is complete
+	if checksum != nil {
+		if err := verifyFile(part, checksum); err != nil {
+			removeCachedDownload(part)
+			return err
+		}
+		err = storeDownload(part, source, checksum, dest)
+	} else {
+		err = os.Rename(part, dest)
+	}
+	if err != nil {
+		return err
+	}
+	os.Remove(part + ".meta.json")
+	line.Set("downloaded %s", filepath.Base(dest))
+	return nil
+}
+
+// readPartValidator returns the ETag or Last-Modified value an unfinished
+// download was fetched with, or "" when there is none
+func readPartValidator(part string) string {
+	data, err := os.ReadFile(part + ".meta.json")
+	if err != nil {
+		return ""
+	}
+	var meta downloadCacheMeta
+	if json.Unmarshal(data, &meta) != nil {
+		return ""
+	}
+	return meta.Validator
+}
+
+// fetchPart downloads source into part, continuing from the end of part if
+// it already has data. validator remembers the ETag or Last-Modified value of
+// the response, saved next to part for later runs, so a resumed request only
+// continues the same file.
+func fetchPart(source, part string, timeout time.Duration, validator *string, line *progressLine) error {
+	file, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if *validator != "" {
+			req.Header.Set("If-Range", *validator)
+		}
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: timeout}).DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+	}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return &transientError{err}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != offset {
+			return restartPart(file, fmt.Errorf("%s: server resumed at the wrong offset", source))
+		}
+	case resp.StatusCode == http.StatusOK:
+		// the server ignored the range or the file changed, start over
+		if err := file.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		offset = 0
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		if size, ok := contentRangeSize(resp.Header.Get("Content-Range")); ok && size == offset {
+			return nil
+		}
+		return restartPart(file, fmt.Errorf("%s: can't resume download", source))
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%s: %w", source, errNotFound)
+	default:
+		err := fmt.Errorf("HTTP request for %s failed with status code: %d", source, resp.StatusCode)
+		if retryableStatus(resp.StatusCode) {
+			return &transientError{err}
+		}
+		return err
+	}
+
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		*validator = etag
+	} else {
+		*validator = resp.Header.Get("Last-Modified")
+	}
+	metaContent, err := json.Marshal(downloadCacheMeta{URL: source, Validator: *validator})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(part+".meta.json", metaContent, 0644); err != nil {
+		return err
+	}
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	bar := line.Bar(total)
+	bar.Set64(offset)
+
+	// give up on a connection that stops sending data
+	idle := time.AfterFunc(timeout, cancel)
+	defer idle.Stop()
+	body := &idleReader{reader: resp.Body, timer: idle, timeout: timeout}
+
+	if _, err := io.Copy(io.MultiWriter(file, bar), body); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("no data received for %s", timeout)
+		}
+		return &transientError{err}
+	}
+	return file.Close()
+}
+
+// restartPart empties a .part file that can't be resumed and returns err as
+// a transient error, so the next attempt downloads from the start
+func restartPart(file *os.File, err error) error {
+	if truncErr := file.Truncate(0); truncErr != nil {
+		return truncErr
+	}
+	return &transientError{err}
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// contentRangeStart parses the first byte of "bytes 100-199/200"
+func contentRangeStart(header string) (int64, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	start, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	return n, err == nil
+}
+
+// contentRangeSize parses the complete length of "bytes */200"
+func contentRangeSize(header string) (int64, bool) {
+	_, size, ok := strings.Cut(header, "/")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	return n, err == nil
+}
+
+// idleReader pushes timer back by timeout on every read
+type idleReader struct {
+	reader  io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+// copySource copies a local file to dest, hashing it on the way
+func copySource(source, dest string, checksum *Checksum, line *progressLine) error {
+	body, contentLength, err := openSource(source)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	file, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var dst io.Writer = io.MultiWriter(file, line.Bar(contentLength))
+	var hasher hash.Hash
+	if checksum != nil {
+		hasher = checksum.New()
+		dst = io.MultiWriter(dst, hasher)
+	}
+
+	_, err = io.Copy(dst, body)
+	if err == nil && checksum != nil {
+		err = checksum.Verify(hasher)
+	}
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		// never leave a partial or unverified copy behind
+		file.Close()
+		os.Remove(dest)
+		return err
+	}
+	return nil
+}
+
+// verifyFile hashes a file and compares it with checksum
+func verifyFile(path string, checksum *Checksum) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hasher := checksum.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return err
+	}
+	return checksum.Verify(hasher)
+}
+
+// downloadSettings reads the retry count and timeout from config.json
+func downloadSettings() (int, time.Duration, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	retries := defaultDownloadRetries
+	if config.DownloadRetries != nil {
+		retries = *config.DownloadRetries
+	}
+
+	timeout := defaultDownloadTimeout
+	if config.DownloadTimeout != "" {
+		timeout, err = time.ParseDuration(config.DownloadTimeout)
+		if err != nil {
+			return 0, 0, fmt.Errorf("config.json: invalid download_timeout '%s': %w", config.DownloadTimeout, err)
+		}
+	}
+	return retries, timeout, nil
+}
+
+// downloadJobs returns how many downloads may run at once: flag, the --jobs
+// value, wins over config.json
+func downloadJobs(flag string) (int, error) {
+	if flag != "" {
+		jobs, err := strconv.Atoi(flag)
+		if err != nil || jobs < 1 {
+			return 0, fmt.Errorf("invalid --jobs '%s'", flag)
+		}
+		return jobs, nil
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return 0, err
+	}
+	if config.DownloadJobs > 0 {
+		return config.DownloadJobs, nil
+	}
+	return defaultDownloadJobs, nil
+}
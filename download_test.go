@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testHome points ~/.boom at a temporary directory with the given
+// config.json, and makes download retries fast
+func testHome(t testing.TB, config string) string {
+	t.Helper()
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, ".boom"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if config != "" {
+		if err := os.WriteFile(filepath.Join(home, ".boom", "config.json"), []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	previousUser, previousDelay := currentUser, retryDelay
+	currentUser = &user.User{HomeDir: home}
+	retryDelay = time.Millisecond
+	t.Cleanup(func() {
+		currentUser, retryDelay = previousUser, previousDelay
+	})
+	return home
+}
+
+// testArtifact is the content served by the test servers
+var testArtifact = bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+func testChecksum(t *testing.T, data []byte) *Checksum {
+	t.Helper()
+	sum := sha256.Sum256(data)
+	checksum, err := parseChecksum("sha256:" + hex.EncodeToString(sum[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return checksum
+}
+
+// serveFrom answers a request for testArtifact, honouring its Range header
+func serveFrom(w http.ResponseWriter, r *http.Request) {
+	var offset int
+	if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &offset); err == nil && offset > 0 {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(testArtifact)-1, len(testArtifact)))
+		w.Header().Set("Content-Length", fmt.Sprint(len(testArtifact)-offset))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(testArtifact[offset:])
+		return
+	}
+	w.Header().Set("Content-Length", fmt.Sprint(len(testArtifact)))
+	w.Write(testArtifact)
+}
+
+// cutConnection sends the first n bytes of testArtifact and drops the
+// connection
+func cutConnection(w http.ResponseWriter, n int) {
+	w.Header().Set("Content-Length", fmt.Sprint(len(testArtifact)))
+	w.Header().Set("ETag", `"v1"`)
+	w.Write(testArtifact[:n])
+	w.(http.Flusher).Flush()
+	panic(http.ErrAbortHandler)
+}
+
+func runDownload(t *testing.T, url string, checksum *Checksum) (string, error) {
+	t.Helper()
+	dest := filepath.Join(t.TempDir(), "artifact")
+	line := newProgressLines().Line("test")
+	return dest, download(url, dest, checksum, line)
+}
+
+func checkArtifact(t *testing.T, dest string) {
+	t.Helper()
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, testArtifact) {
+		t.Fatalf("downloaded %d bytes that don't match the %d byte artifact", len(data), len(testArtifact))
+	}
+}
+
+func TestDownloadResumesDroppedConnection(t *testing.T) {
+	testHome(t, `{"download_retries": 2}`)
+
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range")+" "+r.Header.Get("If-Range"))
+		first := len(ranges) == 1
+		mu.Unlock()
+		if first {
+			cutConnection(w, 1000)
+		}
+		serveFrom(w, r)
+	}))
+	defer server.Close()
+
+	dest, err := runDownload(t, server.URL+"/artifact", testChecksum(t, testArtifact))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkArtifact(t, dest)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ranges) != 2 || ranges[1] != `bytes=1000- "v1"` {
+		t.Fatalf("requests sent Range and If-Range %q, want a resume from byte 1000", ranges)
+	}
+}
+
+// writeStalePart leaves an unfinished download of url behind, as an
+// earlier run would, with the validator it was fetched with
+func writeStalePart(t *testing.T, url string, data []byte, validator string) {
+	t.Helper()
+	if err := os.MkdirAll(downloadsDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(partPath(url), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if validator != "" {
+		meta := fmt.Sprintf(`{"url": %q, "validator": %q}`, url, validator)
+		if err := os.WriteFile(partPath(url)+".meta.json", []byte(meta), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDownloadResumesAcrossRuns(t *testing.T) {
+	testHome(t, `{"download_retries": 0}`)
+
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range")+" "+r.Header.Get("If-Range"))
+		first := len(ranges) == 1
+		mu.Unlock()
+		if first {
+			cutConnection(w, 1000)
+		}
+		w.Header().Set("ETag", `"v1"`)
+		serveFrom(w, r)
+	}))
+	defer server.Close()
+	url := server.URL + "/artifact"
+
+	if _, err := runDownload(t, url, nil); err == nil {
+		t.Fatal("the dropped connection wasn't reported")
+	}
+	dest, err := runDownload(t, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkArtifact(t, dest)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ranges) != 2 || ranges[1] != `bytes=1000- "v1"` {
+		t.Fatalf("requests sent Range and If-Range %q, want the second run to resume from byte 1000", ranges)
+	}
+	if _, err := os.Stat(partPath(url) + ".meta.json"); !os.IsNotExist(err) {
+		t.Fatal("the validator of the finished download was left behind")
+	}
+}
+
+func TestDownloadRestartsChangedFile(t *testing.T) {
+	testHome(t, "")
+
+	var ifRange atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifRange.Store(r.Header.Get("If-Range"))
+		w.Header().Set("ETag", `"v2"`)
+		if r.Header.Get("If-Range") != `"v2"` {
+			// the file changed since the part was fetched, send all of it
+			w.Header().Set("Content-Length", fmt.Sprint(len(testArtifact)))
+			w.Write(testArtifact)
+			return
+		}
+		serveFrom(w, r)
+	}))
+	defer server.Close()
+	url := server.URL + "/artifact"
+	writeStalePart(t, url, bytes.Repeat([]byte("x"), 1000), `"v1"`)
+
+	dest, err := runDownload(t, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkArtifact(t, dest)
+	if got := ifRange.Load(); got != `"v1"` {
+		t.Fatalf("sent If-Range %q, want the validator of the part", got)
+	}
+}
+
+func TestDownloadDiscardsPartWithoutValidator(t *testing.T) {
+	testHome(t, "")
+
+	var ranges atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			ranges.Add(1)
+		}
+		serveFrom(w, r)
+	}))
+	defer server.Close()
+	url := server.URL + "/artifact"
+	// neither a validator nor a hash can tell these bytes are stale
+	writeStalePart(t, url, bytes.Repeat([]byte("x"), 1000), "")
+
+	dest, err := runDownload(t, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkArtifact(t, dest)
+	if n := ranges.Load(); n != 0 {
+		t.Fatalf("resumed an unvalidated part %d times", n)
+	}
+}
+
+func TestDownloadRestartsWhenRangeIsIgnored(t *testing.T) {
+	testHome(t, `{"download_retries": 2}`)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			cutConnection(w, 1000)
+		}
+		// a server without Range support sends the whole file again
+		w.Header().Set("Content-Length", fmt.Sprint(len(testArtifact)))
+		w.Write(testArtifact)
+	}))
+	defer server.Close()
+
+	dest, err := runDownload(t, server.URL+"/artifact", testChecksum(t, testArtifact))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkArtifact(t, dest)
+}
+
+func TestDownloadRangeNotSatisfiable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(testArtifact)))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		serveFrom(w, r)
+	}))
+	defer server.Close()
+	url := server.URL + "/artifact"
+
+	t.Run("complete part", func(t *testing.T) {
+		testHome(t, `{"download_retries": 0}`)
+		os.MkdirAll(downloadsDir(), 0755)
+		os.WriteFile(partPath(url), testArtifact, 0644)
+
+		dest, err := runDownload(t, url, testChecksum(t, testArtifact))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkArtifact(t, dest)
+	})
+
+	t.Run("part longer than the file", func(t *testing.T) {
+		testHome(t, `{"download_retries": 1}`)
+		os.MkdirAll(downloadsDir(), 0755)
+		os.WriteFile(partPath(url), append(testArtifact, "garbage"...), 0644)
+
+		dest, err := runDownload(t, url, testChecksum(t, testArtifact))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkArtifact(t, dest)
+	})
+}
+
+func TestDownloadRetriesServiceUnavailable(t *testing.T) {
+	testHome(t, `{"download_retries": 3}`)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		serveFrom(w, r)
+	}))
+	defer server.Close()
+
+	dest, err := runDownload(t, server.URL+"/artifact", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkArtifact(t, dest)
+	if n := requests.Load(); n != 3 {
+		t.Fatalf("sent %d requests, want 3", n)
+	}
+}
+
+func TestDownloadGivesUpAfterRetries(t *testing.T) {
+	testHome(t, `{"download_retries": 2}`)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := runDownload(t, server.URL+"/artifact", nil)
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("got error %v, want the 503", err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Fatalf("sent %d requests, want 3", n)
+	}
+}
+
+func TestDownloadIdleTimeout(t *testing.T) {
+	testHome(t, `{"download_retries": 0, "download_timeout": "200ms"}`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(testArtifact)))
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(testArtifact[:1000])
+		w.(http.Flusher).Flush()
+		// stall until the client gives up
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	_, err := runDownload(t, server.URL+"/artifact", nil)
+	if err == nil || !strings.Contains(err.Error(), "no data received") {
+		t.Fatalf("got error %v, want an idle timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("gave up after %s", elapsed)
+	}
+
+	// what arrived is kept for the next run, along with its validator
+	if info, err := os.Stat(partPath(server.URL + "/artifact")); err != nil || info.Size() != 1000 {
+		t.Fatalf("part file: %v, want the 1000 bytes received", err)
+	}
+	if validator := readPartValidator(partPath(server.URL + "/artifact")); validator != `"v1"` {
+		t.Fatalf("saved validator %q, want the ETag", validator)
+	}
+}
+
+func TestDownloadRejectsWrongHash(t *testing.T) {
+	testHome(t, "")
+
+	server := httptest.NewServer(http.HandlerFunc(serveFrom))
+	defer server.Close()
+
+	dest, err := runDownload(t, server.URL+"/artifact", testChecksum(t, []byte("something else")))
+	if err == nil {
+		t.Fatal("download with the wrong hash succeeded")
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Fatal("unverified download was left behind")
+	}
+	if _, err := os.Stat(partPath(server.URL + "/artifact")); !os.IsNotExist(err) {
+		t.Fatal("unverified part file was left behind")
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultExtractMaxSize  = 8 << 30
+	defaultExtractMaxFiles = 200000
+)
+
+// extractor writes the entries of an archive below dest. Every path is
+// checked to stay inside dest, symbolic links may only point inside dest and
+// are never written through, and the total size and number of files are
+// limited so a zip bomb fails instead of filling the disk.
+type extractor struct {
+	dest     string
+	maxSize  int64
+	maxFiles int
+	size     int64
+	files    int
+}
+
+func newExtractor(dest string) (*extractor, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	e := &extractor{dest: filepath.Clean(dest), maxSize: defaultExtractMaxSize, maxFiles: defaultExtractMaxFiles}
+	if config.ExtractMaxSize > 0 {
+		e.maxSize = config.ExtractMaxSize
+	}
+	if config.ExtractMaxFiles > 0 {
+		e.maxFiles = config.ExtractMaxFiles
+	}
+	return e, os.MkdirAll(dest, 0755)
+}
+
+// path returns where the archive entry name goes. It fails for names that
+// leave dest (ZipSlip) and for names below a symbolic link, which could
+// point anywhere once other links are followed.
+func (e *extractor) path(name string) (string, error) {
+	path := filepath.Join(e.dest, name)
+	if !insideDir(e.dest, path) {
+		return "", fmt.Errorf("illegal file path: %s", name)
+	}
+
+	rel, _ := filepath.Rel(e.dest, path)
+	parts := strings.Split(rel, string(os.PathSeparator))
+	current := e.dest
+	for _, part := range parts[:len(parts)-1] {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("illegal file path: %s is inside a symbolic link", name)
+		}
+	}
+	return path, nil
+}
+
+// count adds a file to the file limit
+func (e *extractor) count(name string) error {
+	e.files++
+	if e.files > e.maxFiles {
+		return fmt.Errorf("archive has more than %d files", e.maxFiles)
+	}
+	return nil
+}
+
+// Dir creates a directory. It is always writable by its owner, so the files
+// that follow can be unpacked into it.
+func (e *extractor) Dir(name string, mode os.FileMode) error {
+	path, err := e.path(name)
+	if err != nil {
+		return err
+	}
+	if err := e.count(name); err != nil {
+		return err
+	}
+	return os.MkdirAll(path, mode.Perm()|0700)
+}
+
+// File writes a regular file with the permission bits of mode; setuid,
+// setgid and sticky bits are dropped
+func (e *extractor) File(name string, r io.Reader, mode os.FileMode) error {
+	path, err := e.path(name)
+	if err != nil {
+		return err
+	}
+	if err := e.count(name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// read one byte past the limit to notice going over it
+	limited := &io.LimitedReader{R: r, N: e.maxSize - e.size + 1}
+	if err := writeFile(path, limited, mode.Perm()|0600); err != nil {
+		return err
+	}
+	e.size = e.maxSize + 1 - limited.N
+	if e.size > e.maxSize {
+		return fmt.Errorf("archive unpacks to more than %s", formatSize(e.maxSize))
+	}
+	return nil
+}
+
+// Symlink creates a symbolic link. Links that are absolute or lead out of
+// dest are rejected, see checkLinkTarget.
+func (e *extractor) Symlink(name, target string) error {
+	path, err := e.path(name)
+	if err != nil {
+		return err
+	}
+	if err := e.count(name); err != nil {
+		return err
+	}
+	target = filepath.FromSlash(target)
+	if !checkLinkTarget(e.dest, path, target) {
+		return fmt.Errorf("illegal symlink: %s -> %s", name, target)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// a directory turned into a link would move every link that goes
+	// through it
+	if info, err := os.Lstat(path); err == nil && info.IsDir() {
+		return fmt.Errorf("illegal symlink: %s replaces a directory", name)
+	}
+	os.Remove(path)
+	return os.Symlink(target, path)
+}
+
+// checkLinkTarget reports whether a symbolic link at path pointing to target
+// stays inside root. The target must be relative, and may only go up with
+// leading ".." components: those climb real directories, as nothing is
+// unpacked below a link, so comparing the paths as text is exact. A ".."
+// after a folder name, as in "d/s/..", would climb out of wherever d/s
+// points if it is a link, and is rejected. Every link is checked this way,
+// so following the folder names of a target never leaves root either.
+func checkLinkTarget(root, path, target string) bool {
+	if target == "" || filepath.IsAbs(target) || filepath.VolumeName(target) != "" {
+		return false
+	}
+	climbing := true
+	for _, part := range strings.Split(filepath.ToSlash(target), "/") {
+		switch part {
+		case "..":
+			if !climbing {
+				return false
+			}
+		case "", ".":
+		default:
+			climbing = false
+		}
+	}
+	return insideDir(root, filepath.Join(filepath.Dir(path), target))
+}
+
+// checkLinks checks every symbolic link below root with checkLinkTarget.
+// Links are checked while unpacking, but stripping folders from an archive
+// moves them, so they are checked again once the files are in place.
+func checkLinks(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.Type()&fs.ModeSymlink == 0 {
+			return err
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		if !checkLinkTarget(root, path, target) {
+			rel, _ := filepath.Rel(root, path)
+			return fmt.Errorf("illegal symlink: %s -> %s leaves the package directory", filepath.ToSlash(rel), target)
+		}
+		return nil
+	})
+}
+
+// Link creates a hard link to a regular file unpacked earlier
+func (e *extractor) Link(name, target string) error {
+	path, err := e.path(name)
+	if err != nil {
+		return err
+	}
+	targetPath, err := e.path(target)
+	if err != nil {
+		return fmt.Errorf("illegal hard link: %s -> %s", name, target)
+	}
+	if info, err := os.Lstat(targetPath); err != nil || !info.Mode().IsRegular() {
+		return fmt.Errorf("illegal hard link: %s -> %s", name, target)
+	}
+	if err := e.count(name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	os.Remove(path)
+	return os.Link(targetPath, path)
+}
+
+// insideDir reports whether the cleaned path is dir or something below it
+func insideDir(dir, path string) bool {
+	dir = filepath.Clean(dir)
+	path = filepath.Clean(path)
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
+
+// writeFile creates path from r with exactly the permissions perm
+func writeFile(path string, r io.Reader, perm os.FileMode) error {
+	os.Remove(path)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	// OpenFile applies the umask
+	return os.Chmod(path, perm)
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// the limits are small so bombs are caught quickly
+const extractTestConfig = `{"extract_max_size": 1048576, "extract_max_files": 20}`
+
+type tarEntry struct {
+	name string
+	typ  byte
+	link string
+	body string
+	mode int64
+}
+
+func makeTar(t testing.TB, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		mode := e.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		header := &tar.Header{Name: e.name, Typeflag: e.typ, Linkname: e.link, Mode: mode, Size: int64(len(e.body))}
+		if e.typ != tar.TypeReg {
+			header.Size = 0
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipped(t testing.TB, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+type zipEntry struct {
+	name string
+	mode os.FileMode
+	body string
+}
+
+func makeZip(t testing.TB, entries []zipEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		mode := e.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		header.SetMode(mode)
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeArchive(t testing.TB, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// checkContained fails when anything besides dest was created in base, or a
+// link below dest points out of it. Untar and Unzip refuse such a link before
+// creating it, so this holds even when they fail.
+func checkContained(t testing.TB, base, dest string) {
+	t.Helper()
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if filepath.Join(base, entry.Name()) != dest {
+			t.Fatalf("%s was written outside the destination", entry.Name())
+		}
+	}
+	if _, err := os.Lstat(dest); os.IsNotExist(err) {
+		return
+	}
+	if err := checkLinks(dest); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func untarTest(t *testing.T, entries []tarEntry) (string, error) {
+	t.Helper()
+	testHome(t, extractTestConfig)
+	archive := writeArchive(t, "test.tar.gz", gzipped(t, makeTar(t, entries)))
+	base := t.TempDir()
+	dest := filepath.Join(base, "out")
+	err := Untar(archive, dest, "tar.gz")
+	checkContained(t, base, dest)
+	return dest, err
+}
+
+func TestUntarRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		want    string
+	}{
+		{"zip slip", []tarEntry{
+			{name: "../evil", typ: tar.TypeReg, body: "x"},
+		}, "illegal file path"},
+		{"absolute symlink", []tarEntry{
+			{name: "etc", typ: tar.TypeSymlink, link: "/etc"},
+		}, "illegal symlink"},
+		{"symlink out of dest", []tarEntry{
+			{name: "up", typ: tar.TypeSymlink, link: "../x"},
+		}, "illegal symlink"},
+		{"symlink through a symlink", []tarEntry{
+			// d/s resolves to dest, so d/s/.. is its parent although the
+			// text d/s/.. cleans to d
+			{name: "d/", typ: tar.TypeDir, mode: 0755},
+			{name: "d/s", typ: tar.TypeSymlink, link: ".."},
+			{name: "e", typ: tar.TypeSymlink, link: "d/s/.."},
+		}, "illegal symlink"},
+		{"symlink through a later symlink", []tarEntry{
+			{name: "e", typ: tar.TypeSymlink, link: "x/.."},
+			{name: "x", typ: tar.TypeSymlink, link: "."},
+		}, "illegal symlink"},
+		{"symlink replacing a directory", []tarEntry{
+			{name: "d/", typ: tar.TypeDir, mode: 0755},
+			{name: "d", typ: tar.TypeSymlink, link: "."},
+		}, "replaces a directory"},
+		{"symlink chain", []tarEntry{
+			{name: "d", typ: tar.TypeSymlink, link: "."},
+			{name: "d/l", typ: tar.TypeSymlink, link: ".."},
+		}, "inside a symbolic link"},
+		{"write through symlink", []tarEntry{
+			{name: "sub/", typ: tar.TypeDir, mode: 0755},
+			{name: "up", typ: tar.TypeSymlink, link: "sub"},
+			{name: "up/f", typ: tar.TypeReg, body: "x"},
+		}, "inside a symbolic link"},
+		{"hard link out of dest", []tarEntry{
+			{name: "pw", typ: tar.TypeLink, link: "/etc/passwd"},
+		}, "illegal hard link"},
+		{"hard link to a symlink", []tarEntry{
+			{name: "x", typ: tar.TypeReg, body: "x"},
+			{name: "s", typ: tar.TypeSymlink, link: "x"},
+			{name: "h", typ: tar.TypeLink, link: "s"},
+		}, "illegal hard link"},
+		{"too many files", func() []tarEntry {
+			var entries []tarEntry
+			for i := 0; i < 30; i++ {
+				entries = append(entries, tarEntry{name: "f" + strings.Repeat("x", i), typ: tar.TypeReg, body: "x"})
+			}
+			return entries
+		}(), "more than 20 files"},
+		{"too large", []tarEntry{
+			{name: "big", typ: tar.TypeReg, body: strings.Repeat("\x00", 2<<20)},
+		}, "unpacks to more than"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := untarTest(t, test.entries)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("got error %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestUntarPermissionsAndLinks(t *testing.T) {
+	dest, err := untarTest(t, []tarEntry{
+		{name: "bin/", typ: tar.TypeDir, mode: 0755},
+		{name: "bin/tool", typ: tar.TypeReg, body: "#!/bin/sh\n", mode: 06755},
+		{name: "bin/hard", typ: tar.TypeLink, link: "bin/tool"},
+		{name: "bin/soft", typ: tar.TypeSymlink, link: "tool"},
+		{name: "lib", typ: tar.TypeSymlink, link: "bin"},
+		{name: "secret", typ: tar.TypeReg, body: "s", mode: 0400},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(dest, "bin", "tool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode() != 0755 {
+		t.Errorf("bin/tool has mode %s, want setuid and setgid dropped", info.Mode())
+	}
+	if info, err := os.Stat(filepath.Join(dest, "secret")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("secret: %v, want it readable and writable by its owner", err)
+	}
+	if target, err := os.Readlink(filepath.Join(dest, "bin", "soft")); err != nil || target != "tool" {
+		t.Errorf("bin/soft links to %q (%v), want tool", target, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dest, "lib", "hard")); err != nil || string(data) != "#!/bin/sh\n" {
+		t.Errorf("lib/hard: %q, %v", data, err)
+	}
+}
+
+func unzipTest(t *testing.T, entries []zipEntry) (string, error) {
+	t.Helper()
+	testHome(t, extractTestConfig)
+	archive := writeArchive(t, "test.zip", makeZip(t, entries))
+	base := t.TempDir()
+	dest := filepath.Join(base, "out")
+	err := Unzip(archive, dest)
+	checkContained(t, base, dest)
+	return dest, err
+}
+
+func TestUnzipRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []zipEntry
+		want    string
+	}{
+		{"zip slip", []zipEntry{
+			{name: "../../evil", body: "x"},
+		}, "illegal file path"},
+		{"absolute symlink", []zipEntry{
+			{name: "etc", mode: os.ModeSymlink | 0777, body: "/etc"},
+		}, "illegal symlink"},
+		{"symlink through a symlink", []zipEntry{
+			{name: "d/", mode: fs.ModeDir | 0755},
+			{name: "d/s", mode: os.ModeSymlink | 0777, body: ".."},
+			{name: "e", mode: os.ModeSymlink | 0777, body: "d/s/.."},
+		}, "illegal symlink"},
+		{"zip bomb", []zipEntry{
+			{name: "zeros", body: strings.Repeat("\x00", 4<<20)},
+		}, "unpacks to more than"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := unzipTest(t, test.entries)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("got error %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestUnzipPermissions(t *testing.T) {
+	dest, err := unzipTest(t, []zipEntry{
+		{name: "tool", mode: os.ModeSetuid | 0755, body: "#!/bin/sh\n"},
+		{name: "link", mode: os.ModeSymlink | 0777, body: "tool"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(dest, "tool")); err != nil || info.Mode() != 0755 {
+		t.Errorf("tool: %v, want mode 0755", err)
+	}
+	if target, err := os.Readlink(filepath.Join(dest, "link")); err != nil || target != "tool" {
+		t.Errorf("link links to %q (%v), want tool", target, err)
+	}
+}
+
+// unpackTest unpacks a tar.gz release into base/pkg/1.0, the way an install
+// does
+func unpackTest(t *testing.T, release Release, entries []tarEntry) (string, error) {
+	t.Helper()
+	testHome(t, extractTestConfig)
+	base := t.TempDir()
+	dir := filepath.Join(base, "pkg", "1.0")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(dir, "tool.tar.gz")
+	if err := os.WriteFile(archive, gzipped(t, makeTar(t, entries)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	release.Version = "1.0"
+	release.Install = "tar.gz"
+	pkg := &Manifest{Name: "pkg", Release: release}
+	err := unpackArchive(pkg, archive, dir)
+	// a failed install discards dir, so only a successful one has to be clean
+	if err == nil {
+		checkContained(t, filepath.Join(base, "pkg"), dir)
+	}
+	return dir, err
+}
+
+func TestUnpackChecksLinksAfterStripping(t *testing.T) {
+	strip := 1
+	tests := []struct {
+		name    string
+		release Release
+		entries []tarEntry
+	}{
+		{"automatic strip", Release{Executeble: "bin/x"}, []tarEntry{
+			// inside the archive the link points to tool/../x
+			{name: "tool/bin/x", typ: tar.TypeReg, body: "x", mode: 0755},
+			{name: "tool/bin/link", typ: tar.TypeSymlink, link: "../../x"},
+		}},
+		{"strip_components", Release{Executeble: "bin/x", StripComponents: &strip}, []tarEntry{
+			{name: "tool/bin/x", typ: tar.TypeReg, body: "x", mode: 0755},
+			{name: "tool/bin/link", typ: tar.TypeSymlink, link: "../../x"},
+		}},
+		{"extract_dir", Release{Executeble: "x", ExtractDir: "tool/bin"}, []tarEntry{
+			{name: "tool/bin/x", typ: tar.TypeReg, body: "x", mode: 0755},
+			{name: "tool/bin/link", typ: tar.TypeSymlink, link: "../share"},
+			{name: "tool/share/", typ: tar.TypeDir, mode: 0755},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := unpackTest(t, test.release, test.entries)
+			if err == nil || !strings.Contains(err.Error(), "leaves the package directory") {
+				t.Fatalf("got error %v, want the link to be rejected", err)
+			}
+		})
+	}
+}
+
+func TestUnpackStripKeepsLinksInside(t *testing.T) {
+	dir, err := unpackTest(t, Release{Executeble: "bin/x"}, []tarEntry{
+		{name: "tool/bin/x", typ: tar.TypeReg, body: "x", mode: 0755},
+		{name: "tool/bin/link", typ: tar.TypeSymlink, link: "x"},
+		{name: "tool/lib", typ: tar.TypeSymlink, link: "bin"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "lib", "link")); err != nil || string(data) != "x" {
+		t.Fatalf("lib/link: %q, %v", data, err)
+	}
+}
+
+func TestUnpackDoesNotMergeThroughLinks(t *testing.T) {
+	// after stripping, a/x -> ../c lands in the package directory pointing
+	// out of it, and b/x/f must not be written through it
+	strip := 1
+	dir, err := unpackTest(t, Release{Executeble: "x/f", StripComponents: &strip}, []tarEntry{
+		{name: "c/", typ: tar.TypeDir, mode: 0755},
+		{name: "a/x", typ: tar.TypeSymlink, link: "../c"},
+		{name: "b/x/f", typ: tar.TypeReg, body: "f"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "..", "c", "f")); !os.IsNotExist(err) {
+		t.Fatal("b/x/f was written through the a/x link")
+	}
+	if info, err := os.Lstat(filepath.Join(dir, "x")); err != nil || !info.IsDir() {
+		t.Fatalf("x: %v, want the directory from b/x", err)
+	}
+}
+
+// fuzzSeeds are archive contents that once got past the checks
+func fuzzTarSeeds(f *testing.F) [][]byte {
+	return [][]byte{
+		makeTar(f, []tarEntry{{name: "../evil", typ: tar.TypeReg, body: "x"}}),
+		makeTar(f, []tarEntry{
+			{name: "d/", typ: tar.TypeDir, mode: 0755},
+			{name: "d/s", typ: tar.TypeSymlink, link: ".."},
+			{name: "e", typ: tar.TypeSymlink, link: "d/s/.."},
+			{name: "e/f", typ: tar.TypeReg, body: "x"},
+		}),
+		makeTar(f, []tarEntry{
+			{name: "up", typ: tar.TypeSymlink, link: "sub"},
+			{name: "up/f", typ: tar.TypeReg, body: "x"},
+			{name: "h", typ: tar.TypeLink, link: "up/f"},
+		}),
+	}
+}
+
+func FuzzUntar(f *testing.F) {
+	for _, seed := range fuzzTarSeeds(f) {
+		f.Add(seed)
+	}
+	testHome(f, extractTestConfig)
+	archiveDir := f.TempDir()
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		archive := filepath.Join(archiveDir, "fuzz.tar.gz")
+		if err := os.WriteFile(archive, gzipped(t, data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		base := t.TempDir()
+		dest := filepath.Join(base, "out")
+		Untar(archive, dest, "tar.gz")
+		checkContained(t, base, dest)
+	})
+}
+
+func FuzzUnzip(f *testing.F) {
+	f.Add(makeZip(f, []zipEntry{{name: "../../evil", body: "x"}}))
+	f.Add(makeZip(f, []zipEntry{
+		{name: "d/s", mode: os.ModeSymlink | 0777, body: ".."},
+		{name: "e", mode: os.ModeSymlink | 0777, body: "d/s/.."},
+		{name: "e/f", body: "x"},
+	}))
+	testHome(f, extractTestConfig)
+	archiveDir := f.TempDir()
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		archive := filepath.Join(archiveDir, "fuzz.zip")
+		if err := os.WriteFile(archive, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		base := t.TempDir()
+		dest := filepath.Join(base, "out")
+		Unzip(archive, dest)
+		checkContained(t, base, dest)
+	})
+}
@@ -2,11 +2,15 @@ module boom
 
 go 1.21.1
 
+require (
+	github.com/schollz/progressbar/v3 v3.13.1
+	github.com/ulikunitz/xz v0.5.15
+)
+
 require (
 	github.com/mattn/go-runewidth v0.0.15 // indirect
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
 	github.com/rivo/uniseg v0.4.4 // indirect
-	github.com/schollz/progressbar/v3 v3.13.1 // indirect
 	golang.org/x/sys v0.13.0 // indirect
 	golang.org/x/term v0.13.0 // indirect
 )
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// setHold marks packages as held or releases them. Held packages stay on
+// their current version: `update --all` skips them and `outdated` reports
+// them as held.
+func setHold(hold bool) {
+	args := parseArgs(os.Args[2:])
+	if len(args.Positional) < 1 {
+		if hold {
+			fmt.Println("Usage: boom hold <package>...")
+		} else {
+			fmt.Println("Usage: boom unhold <package>...")
+		}
+		return
+	}
+
+	installed, err := loadInstalled()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	changed := false
+	for _, name := range args.Positional {
+		record := installed.Find(name)
+		if record == nil {
+			fmt.Printf("Package '%s' is not installed.\n", name)
+			continue
+		}
+		if record.Held == hold {
+			if hold {
+				fmt.Printf("Package '%s' is already held.\n", name)
+			} else {
+				fmt.Printf("Package '%s' is not held.\n", name)
+			}
+			continue
+		}
+
+		record.Held = hold
+		changed = true
+		if hold {
+			fmt.Printf("Package '%s' held at version %s.\n", name, record.Version)
+		} else {
+			fmt.Printf("Package '%s' is no longer held.\n", name)
+		}
+	}
+
+	if changed {
+		if err := installed.save(); err != nil {
+			fmt.Println("Error:", err)
+		}
+	}
+}
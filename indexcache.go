@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// IndexOptions controls how registry indexes are loaded
+type IndexOptions struct {
+	// Insecure turns signature failures into warnings
+	Insecure bool
+	// Offline uses only the on-disk cache and never touches the network
+	Offline bool
+	// Refresh re-downloads every remote index, ignoring the TTL and validators
+	Refresh bool
+}
+
+// indexCacheMeta records how a cached index was fetched, so it can be
+// revalidated with a conditional request
+type indexCacheMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// defaultIndexTTL is how long a cached index is used without revalidation
+const defaultIndexTTL = time.Hour
+
+func indexCacheDir() string {
+	return filepath.Join(currentUser.HomeDir, ".boom", "cache", "index")
+}
+
+func indexCachePaths(registry string) (data, signature, meta string) {
+	base := filepath.Join(indexCacheDir(), registry)
+	return base + ".json", base + ".json.sig", base + ".meta.json"
+}
+
+// fetchRemoteIndex returns the index and detached signature of an http(s)
+// registry, going through the cache in ~/.boom/cache/index. A nil signature
+// means the registry has none.
+func fetchRemoteIndex(registry RegistryConfig, opts IndexOptions) ([]byte, []byte, error) {
+	dataPath, sigPath, metaPath := indexCachePaths(registry.Name)
+
+	var meta indexCacheMeta
+	cached, err := os.ReadFile(dataPath)
+	if err == nil {
+		if content, err := os.ReadFile(metaPath); err == nil {
+			json.Unmarshal(content, &meta)
+		}
+		if meta.URL != registry.URL {
+			// the registry was pointed somewhere else since it was cached
+			cached = nil
+		}
+	}
+	readCachedSignature := func() []byte {
+		signature, err := os.ReadFile(sigPath)
+		if err != nil {
+			return nil
+		}
+		return signature
+	}
+
+	if opts.Offline {
+		if cached == nil {
+			return nil, nil, fmt.Errorf("no cached index, run 'boom refresh' while online")
+		}
+		return cached, readCachedSignature(), nil
+	}
+
+	if cached != nil && !opts.Refresh {
+		ttl, err := indexTTL()
+		if err != nil {
+			return nil, nil, err
+		}
+		if time.Since(meta.FetchedAt) < ttl {
+			return cached, readCachedSignature(), nil
+		}
+	} else {
+		// ask for the full index
+		meta.ETag, meta.LastModified = "", ""
+	}
+
+	data, notModified, err := fetchConditional(registry.URL, &meta)
+	if err != nil {
+		if cached != nil {
+			fmt.Fprintf(os.Stderr, "Warning: registry '%s': %s, using the cached index from %s\n", registry.Name, err, meta.FetchedAt.Local().Format(time.DateTime))
+			return cached, readCachedSignature(), nil
+		}
+		return nil, nil, err
+	}
+
+	var signature []byte
+	if notModified {
+		data = cached
+		signature = readCachedSignature()
+	} else {
+		signature, err = readSignature(registry.URL)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	meta.URL = registry.URL
+	meta.FetchedAt = time.Now()
+	if err := writeIndexCache(registry.Name, data, signature, &meta); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: could not cache index:", err)
+	}
+	return data, signature, nil
+}
+
+// fetchConditional downloads url, sending the validators stored in meta. It
+// updates meta with the new validators and reports whether the server
+// answered 304 Not Modified.
+func fetchConditional(url string, meta *indexCacheMeta) ([]byte, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if meta.ETag != "" {
+		req.Header.Set("If-None-Match", meta.ETag)
+	}
+	if meta.LastModified != "" {
+		req.Header.Set("If-Modified-Since", meta.LastModified)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, true, nil
+	case http.StatusOK:
+	default:
+		return nil, false, fmt.Errorf("HTTP request for %s failed with status code: %d", url, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	meta.ETag = resp.Header.Get("ETag")
+	meta.LastModified = resp.Header.Get("Last-Modified")
+	return data, false, nil
+}
+
+func writeIndexCache(registry string, data, signature []byte, meta *indexCacheMeta) error {
+	dataPath, sigPath, metaPath := indexCachePaths(registry)
+	if err := os.MkdirAll(indexCacheDir(), 0755); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(dataPath, data, 0644); err != nil {
+		return err
+	}
+	if signature != nil {
+		if err := writeFileAtomic(sigPath, signature, 0644); err != nil {
+			return err
+		}
+	} else if err := os.Remove(sigPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	metaContent, err := json.MarshalIndent(meta, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(metaPath, metaContent, 0644)
+}
+
+// removeIndexCache deletes the cached index of a registry
+func removeIndexCache(registry string) {
+	dataPath, sigPath, metaPath := indexCachePaths(registry)
+	for _, path := range []string{dataPath, sigPath, metaPath} {
+		os.Remove(path)
+	}
+}
+
+// indexTTL returns the configured index cache lifetime
+func indexTTL() (time.Duration, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return 0, err
+	}
+	if config.IndexTTL == "" {
+		return defaultIndexTTL, nil
+	}
+	ttl, err := time.ParseDuration(config.IndexTTL)
+	if err != nil {
+		return 0, fmt.Errorf("config.json: invalid index_ttl '%s': %w", config.IndexTTL, err)
+	}
+	return ttl, nil
+}
+
+func refresh() {
+	// signatures are checked again whenever the cached index is used, so a
+	// refresh only warns about them
+	index, err := loadIndex(IndexOptions{Insecure: true, Refresh: true})
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Printf("Package index refreshed, %d packages available.\n", len(index.Entries))
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// installedSchemaVersion is the newest installed.json schema this BOOM understands.
+// Schema 2 keeps every version in its own programs/<name>/<version> directory.
+const installedSchemaVersion = 2
+
+// InstalledPackage is a package record in installed.json. The embedded
+// manifest's top-level release is the current version, the one `boom run`
+// starts; Versions lists every version installed side by side.
+type InstalledPackage struct {
+	Manifest
+	Registry string `json:"registry,omitempty"`
+	// Held packages are pinned to their current version
+	Held bool `json:"held,omitempty"`
+	// Reason is why the package is installed: reasonExplicit when the user
+	// asked for it, reasonDependency when another package needed it
+	Reason string `json:"reason,omitempty"`
+}
+
+const (
+	reasonExplicit   = "explicit"
+	reasonDependency = "dependency"
+)
+
+// Explicit reports whether the user installed the package themselves.
+// Records from before dependencies existed have no reason and count as explicit.
+func (p *InstalledPackage) Explicit() bool {
+	return p.Reason != reasonDependency
+}
+
+// InstalledDB is the decoded form of installed.json
+type InstalledDB struct {
+	Schema   int                `json:"schema"`
+	Packages []InstalledPackage `json:"packages"`
+}
+
+func installedPath() string {
+	return filepath.Join(currentUser.HomeDir, ".boom", "installed.json")
+}
+
+// loadInstalled reads installed.json. A missing file is an empty database.
+func loadInstalled() (*InstalledDB, error) {
+	db := &InstalledDB{Schema: installedSchemaVersion, Packages: []InstalledPackage{}}
+
+	jsonFile, err := os.Open(installedPath())
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer jsonFile.Close()
+
+	if err := json.NewDecoder(jsonFile).Decode(db); err != nil {
+		return nil, fmt.Errorf("decoding installed.json: %w", err)
+	}
+	if err := checkSchema(db.Schema, installedSchemaVersion); err != nil {
+		return nil, err
+	}
+	if db.Schema < 2 {
+		// commands like run don't hold the lock, so take it and read
+		// installed.json again, in case another process migrated it first
+		if !lockHeld {
+			unlock, err := waitLockBoom(30 * time.Second)
+			if err != nil {
+				return nil, fmt.Errorf("migrating installed.json: %w", err)
+			}
+			defer unlock()
+			jsonFile.Close()
+			return loadInstalled()
+		}
+		if err := migrateVersionDirs(db); err != nil {
+			return nil, fmt.Errorf("migrating installed.json: %w", err)
+		}
+	}
+	db.Schema = installedSchemaVersion
+
+	for i := range db.Packages {
+		if err := db.Packages[i].Validate(); err != nil {
+			return nil, fmt.Errorf("installed.json: %w", err)
+		}
+	}
+
+	return db, nil
+}
+
+// save writes the database back to installed.json and brings the shims up
+// to date with it
+func (db *InstalledDB) save() error {
+	jsonContent, err := db.encode()
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(installedPath(), jsonContent, 0644); err != nil {
+		return err
+	}
+
+	// the programs are installed either way, `boom shims rebuild` can retry
+	if _, err := writeShims(db); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: updating shims:", err)
+	}
+	return nil
+}
+
+// encode returns the content save writes to installed.json
+func (db *InstalledDB) encode() ([]byte, error) {
+	return json.MarshalIndent(db, "", "    ")
+}
+
+// Find returns the installed record for a package, or nil
+func (db *InstalledDB) Find(name string) *InstalledPackage {
+	for i := range db.Packages {
+		if db.Packages[i].Name == name {
+			return &db.Packages[i]
+		}
+	}
+	return nil
+}
+
+// Providers returns the installed packages that are called name or provide
+// it as a virtual name
+func (db *InstalledDB) Providers(name string) []*InstalledPackage {
+	var providers []*InstalledPackage
+	for i := range db.Packages {
+		if db.Packages[i].ProvidesName(db.Packages[i].Name, name) {
+			providers = append(providers, &db.Packages[i])
+		}
+	}
+	return providers
+}
+
+// Add appends a record, replacing any existing record with the same name
+func (db *InstalledDB) Add(pkg InstalledPackage) {
+	db.Remove(pkg.Name)
+	db.Packages = append(db.Packages, pkg)
+}
+
+// Record adds an installed release and makes it the current version. An
+// explicit install marks the package as explicitly installed; otherwise a
+// new record is marked as a dependency and an existing record keeps its
+// reason.
+func (db *InstalledDB) Record(entry *IndexEntry, explicit bool) {
+	record := db.Find(entry.Name)
+	if record == nil {
+		db.Add(InstalledPackage{Manifest: entry.Manifest, Registry: entry.Registry, Reason: reasonDependency})
+		record = db.Find(entry.Name)
+	}
+	if explicit {
+		record.Reason = reasonExplicit
+	}
+
+	versions := record.Versions
+	record.Manifest = entry.Manifest
+	record.Versions = versions
+	record.Registry = entry.Registry
+	record.AddRelease(entry.Release)
+}
+
+// Remove deletes the record for a package and reports whether it existed
+func (db *InstalledDB) Remove(name string) bool {
+	for i := range db.Packages {
+		if db.Packages[i].Name == name {
+			db.Packages = append(db.Packages[:i], db.Packages[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func programDir(name string) string {
+	return filepath.Join(currentUser.HomeDir, ".boom", "programs", name)
+}
+
+// versionDir is the directory one installed version of a package lives in
+func versionDir(name, version string) string {
+	return filepath.Join(programDir(name), version)
+}
+
+// Dir returns the directory of the current version
+func (p *InstalledPackage) Dir() string {
+	return versionDir(p.Name, p.Version)
+}
+
+// AddRelease records an installed version, replacing an older record of the
+// same version
+func (p *InstalledPackage) AddRelease(release Release) {
+	p.RemoveRelease(release.Version)
+	p.Versions = append(p.Versions, release)
+	p.Versions = p.Releases()
+}
+
+// RemoveRelease forgets an installed version and reports whether it existed
+func (p *InstalledPackage) RemoveRelease(version string) bool {
+	for i, release := range p.Versions {
+		if release.Version == version {
+			p.Versions = append(p.Versions[:i], p.Versions[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// FindRelease returns an installed version
+func (p *InstalledPackage) FindRelease(version string) (Release, bool) {
+	for _, release := range p.Versions {
+		if release.Version == version {
+			return release, true
+		}
+	}
+	return Release{}, false
+}
+
+// migrateVersionDirs moves schema 1 installs, which kept their files directly
+// in programs/<name>, into programs/<name>/<version>
+func migrateVersionDirs(db *InstalledDB) error {
+	for i := range db.Packages {
+		pkg := &db.Packages[i]
+		dir := programDir(pkg.Name)
+
+		if _, err := os.Stat(dir); err == nil {
+			moved := dir + ".migrating"
+			if err := os.Rename(dir, moved); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			if err := os.Rename(moved, pkg.Dir()); err != nil {
+				return err
+			}
+		}
+
+		pkg.Versions = nil
+		pkg.AddRelease(pkg.Release)
+	}
+
+	db.Schema = 2
+	return db.save()
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// TrustedKey is an ed25519 public key from the trust store in ~/.boom/keys
+type TrustedKey struct {
+	Name string
+	Key  ed25519.PublicKey
+}
+
+// ErrUnsigned is returned when an index has no detached signature
+var ErrUnsigned = errors.New("package index is not signed")
+
+func keysDir() string {
+	return filepath.Join(currentUser.HomeDir, ".boom", "keys")
+}
+
+func keyCommand() {
+	args := parseArgs(os.Args[2:])
+
+	switch args.Arg(0) {
+	case "add":
+		if len(args.Positional) < 3 {
+			fmt.Println("Usage: boom key add <name> <base64 key|key file>")
+			return
+		}
+		if err := addKey(args.Arg(1), args.Arg(2)); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Printf("Key '%s' added to the trust store.\n", args.Arg(1))
+	case "list":
+		keys, err := loadTrustedKeys()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Name\tPublic Key")
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s\t%s\n", key.Name, base64.StdEncoding.EncodeToString(key.Key))
+		}
+		w.Flush()
+	case "remove":
+		if len(args.Positional) < 2 {
+			fmt.Println("Usage: boom key remove <name>")
+			return
+		}
+		if err := removeKey(args.Arg(1)); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Printf("Key '%s' removed from the trust store.\n", args.Arg(1))
+	default:
+		fmt.Println("Usage: boom key <add|list|remove> [arguments]")
+	}
+}
+
+// addKey stores a public key given either inline or as a path to a key file
+func addKey(name, source string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid key name '%s'", name)
+	}
+
+	data := []byte(source)
+	if content, err := os.ReadFile(source); err == nil {
+		data = content
+	}
+
+	key, err := parsePublicKey(data)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(keysDir(), 0755); err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(key) + "\n"
+	return writeFileAtomic(filepath.Join(keysDir(), name+".pub"), []byte(encoded), 0644)
+}
+
+func removeKey(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid key name '%s'", name)
+	}
+	err := os.Remove(filepath.Join(keysDir(), name+".pub"))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no key named '%s'", name)
+	}
+	return err
+}
+
+// loadTrustedKeys reads every *.pub file in the trust store
+func loadTrustedKeys() ([]TrustedKey, error) {
+	files, err := filepath.Glob(filepath.Join(keysDir(), "*.pub"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var keys []TrustedKey
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		key, err := parsePublicKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		keys = append(keys, TrustedKey{Name: strings.TrimSuffix(filepath.Base(file), ".pub"), Key: key})
+	}
+	return keys, nil
+}
+
+// parsePublicKey accepts a base64 encoded raw ed25519 key or a PEM encoded
+// PKIX key as written by `openssl pkey -pubout`
+func parsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key: %w", err)
+		}
+		key, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key is not an ed25519 key")
+		}
+		return key, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key: expected %d bytes, got %d", ed25519.PublicKeySize, len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// parseSignature accepts a raw 64 byte signature or its base64 encoding
+func parseSignature(data []byte) ([]byte, error) {
+	if len(data) == ed25519.SignatureSize {
+		return data, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(raw) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("malformed signature")
+	}
+	return raw, nil
+}
+
+// verifySignature checks a detached signature over data against the trust
+// store and returns the name of the key that signed it
+func verifySignature(data, signature []byte) (string, error) {
+	if signature == nil {
+		return "", ErrUnsigned
+	}
+	sig, err := parseSignature(signature)
+	if err != nil {
+		return "", err
+	}
+
+	keys, err := loadTrustedKeys()
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "", fmt.Errorf("no trusted keys, add one with 'boom key add'")
+	}
+
+	for _, key := range keys {
+		if ed25519.Verify(key.Key, data, sig) {
+			return key.Name, nil
+		}
+	}
+	return "", fmt.Errorf("bad signature: not signed by any trusted key")
+}
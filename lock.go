@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockedCommands change the state in ~/.boom and hold its lock while they
+// run. Commands with subcommands only lock for the listed ones, so listing
+// keys or registries works while an install is running.
+var lockedCommands = map[string][]string{
+	"install":    nil,
+	"uninstall":  nil,
+	"autoremove": nil,
+	"update":     nil,
+	"switch":     nil,
+	"hold":       nil,
+	"unhold":     nil,
+	"key":        {"add", "remove"},
+	"registry":   {"add", "remove"},
+	"refresh":    nil,
+	"cache":      {"clean"},
+	"shims":      {"rebuild"},
+}
+
+// needsLock reports whether a command line changes ~/.boom
+func needsLock(args []string) bool {
+	subcommands, ok := lockedCommands[args[0]]
+	if !ok {
+		return false
+	}
+	if subcommands == nil {
+		return true
+	}
+	// the flags that take a value, so theirs isn't taken for the subcommand
+	subcommand := parseArgs(args[1:], "older-than", "priority").Arg(0)
+	return slices.Contains(subcommands, subcommand)
+}
+
+// lockHeld is set while this process holds the lock
+var lockHeld bool
+
+// BusyError is returned by lockBoom when another process holds the lock
+type BusyError struct {
+	// Pid is the holder's process id, or 0 when it isn't known
+	Pid int
+}
+
+func (e *BusyError) Error() string {
+	if e.Pid == 0 {
+		return "another boom process is running"
+	}
+	return fmt.Sprintf("another boom process is running (pid %d)", e.Pid)
+}
+
+func lockPath() string {
+	return filepath.Join(currentUser.HomeDir, ".boom", "lock")
+}
+
+// lockBoom takes the exclusive lock on ~/.boom and writes our pid into the
+// lock file. The lock belongs to the open file, so the operating system
+// releases it when the process exits, even if it crashes. Call the returned
+// function to release it earlier.
+func lockBoom() (func(), error) {
+	file, err := os.OpenFile(lockPath(), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockFile(file); err != nil {
+		file.Close()
+		if err != errLocked {
+			return nil, fmt.Errorf("locking %s: %w", lockPath(), err)
+		}
+		// the holder wrote its pid when it took the lock
+		data, _ := os.ReadFile(lockPath())
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+		return nil, &BusyError{Pid: pid}
+	}
+	lockHeld = true
+
+	// overwrite the previous pid in place, so the file is never empty
+	pid := []byte(strconv.Itoa(os.Getpid()) + "\n")
+	if _, err := file.WriteAt(pid, 0); err == nil {
+		file.Truncate(int64(len(pid)))
+	}
+
+	return func() {
+		lockHeld = false
+		unlockFile(file)
+		file.Close()
+	}, nil
+}
+
+// waitLockBoom is lockBoom for commands that don't take the lock otherwise
+// and only need it briefly: it waits up to timeout for another process to
+// release it
+func waitLockBoom(timeout time.Duration) (func(), error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		unlock, err := lockBoom()
+		var busy *BusyError
+		if !errors.As(err, &busy) || time.Now().After(deadline) {
+			return unlock, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// over path, so readers see either the old or the new content, never a
+// partly written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	tmpPath := file.Name()
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNeedsLock(t *testing.T) {
+	tests := map[string]bool{
+		"install atk":                      true,
+		"switch atk 1.2.2":                 true,
+		"refresh":                          true,
+		"run atk":                          false,
+		"list":                             false,
+		"outdated --json":                  false,
+		"key list":                         false,
+		"key add jooapa key.pub":           true,
+		"registry list":                    false,
+		"registry add corp /srv/boom":      true,
+		"registry --priority 1 add corp x": true,
+		"cache list":                       false,
+		"cache size":                       false,
+		"cache clean":                      true,
+		"cache --older-than 30d clean":     true,
+		"shims rebuild":                    true,
+	}
+
+	for command, want := range tests {
+		if got := needsLock(strings.Fields(command)); got != want {
+			t.Errorf("needsLock(%q) = %v, want %v", command, got, want)
+		}
+	}
+}
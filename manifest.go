@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// indexSchemaVersion is the newest db.json schema this BOOM understands
+const indexSchemaVersion = 2
+
+// Index is a decoded registry index (db.json)
+type Index struct {
+	Schema   int        `json:"schema,omitempty"`
+	Packages []Manifest `json:"packages"`
+}
+
+// Manifest describes one package in a registry index
+type Manifest struct {
+	Name        string `json:"name"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Author      string `json:"author,omitempty"`
+
+	// Release holds the top-level version fields. Once an index is decoded
+	// it is always the latest release.
+	Release
+
+	// Versions lists every release of the package (schema 2). Fields left
+	// out of an entry are inherited from the top-level release fields.
+	Versions []Release `json:"versions,omitempty"`
+}
+
+// Release is one downloadable version of a package
+type Release struct {
+	Version    string `json:"version,omitempty"`
+	Download   string `json:"download,omitempty"`
+	Install    string `json:"install,omitempty"`
+	Executeble string `json:"executeble,omitempty"`
+	Hash       string `json:"hash,omitempty"`
+	// Depends lists required packages as "name" or "name@constraint",
+	// optionally prefixed with "registry/"
+	Depends []string `json:"depends,omitempty"`
+	// Provides lists virtual package names, such as "calculator", that
+	// dependencies can be satisfied with
+	Provides []string `json:"provides,omitempty"`
+	// Conflicts lists packages, as "name" or "name@constraint", that must
+	// never be installed together with this one
+	Conflicts []string `json:"conflicts,omitempty"`
+	// ExtractDir is the folder inside an archive whose contents are
+	// installed, such as "speedcrunch-0.12/bin"
+	ExtractDir string `json:"extract_dir,omitempty"`
+	// StripComponents removes this many leading folders from every path in
+	// an archive. Without it or extract_dir, a single top-level folder is
+	// stripped automatically.
+	StripComponents *int `json:"strip_components,omitempty"`
+	// Bin lists the programs the package contains, for packages with more
+	// than the one in executeble
+	Bin []Bin `json:"bin,omitempty"`
+}
+
+// Bin is one program in a package. In a manifest it is either just the path
+// or an object with an alias and default arguments.
+type Bin struct {
+	// Path is the program's path inside the package directory
+	Path string `json:"path"`
+	// Name is the command the program is run by. It defaults to the file
+	// name without ".exe" or ".sh".
+	Name string `json:"name,omitempty"`
+	// Args are put before the arguments the program is run with
+	Args []string `json:"args,omitempty"`
+}
+
+func (b *Bin) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*b = Bin{}
+		return json.Unmarshal(data, &b.Path)
+	}
+
+	// a separate type, so decoding the object doesn't call this again
+	type bin Bin
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode((*bin)(b))
+}
+
+// Command is the name the program is run by
+func (b *Bin) Command() string {
+	if b.Name != "" {
+		return b.Name
+	}
+	return commandName(b.Path)
+}
+
+// Bins returns every program of the release. The executeble comes first,
+// it is what `boom run <package>` starts.
+func (r *Release) Bins() []Bin {
+	var bins []Bin
+	if r.Executeble != "" && !slices.ContainsFunc(r.Bin, func(b Bin) bool { return b.Path == r.Executeble }) {
+		bins = append(bins, Bin{Path: r.Executeble})
+	}
+	return append(bins, r.Bin...)
+}
+
+// FindBin returns the program that is run by the command name
+func (r *Release) FindBin(name string) (Bin, bool) {
+	for _, bin := range r.Bins() {
+		if bin.Command() == name {
+			return bin, true
+		}
+	}
+	return Bin{}, false
+}
+
+// ProvidesName reports whether the release is called name or provides it
+func (r *Release) ProvidesName(pkg, name string) bool {
+	if pkg == name {
+		return true
+	}
+	for _, provided := range r.Provides {
+		if provided == name {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldError reports a missing or invalid field in a package manifest
+type FieldError struct {
+	Package string
+	Field   string
+	Reason  string
+}
+
+func (e *FieldError) Error() string {
+	if e.Package == "" {
+		return fmt.Sprintf("invalid package manifest: field '%s' %s", e.Field, e.Reason)
+	}
+	return fmt.Sprintf("invalid manifest for package '%s': field '%s' %s", e.Package, e.Field, e.Reason)
+}
+
+// namePattern matches valid package, registry and key names
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// installTypes lists every value accepted in a manifest's "install" field
+var installTypes = map[string]bool{
+	"exe":     true,
+	"setup":   true,
+	"zip":     true,
+	"tar.gz":  true,
+	"tar.xz":  true,
+	"tar.bz2": true,
+	"gzip":    true,
+}
+
+// Validate checks that all required fields are present and well formed
+func (m *Manifest) Validate() error {
+	if m.Name == "" {
+		return &FieldError{Field: "name", Reason: "is missing"}
+	}
+	if !namePattern.MatchString(m.Name) {
+		return &FieldError{Package: m.Name, Field: "name", Reason: "may only contain letters, digits, '.', '_' and '-'"}
+	}
+
+	// with a versions list, the top-level fields may be just defaults
+	if len(m.Versions) == 0 || m.Version != "" {
+		if err := m.Release.validate(m.Name, ""); err != nil {
+			return err
+		}
+	}
+	for i, release := range m.Versions {
+		release = m.inherit(release)
+		if err := release.validate(m.Name, fmt.Sprintf("versions[%d].", i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// insidePackage reports whether a path from a manifest is a file inside the
+// package directory, with either kind of slash
+func insidePackage(file string) bool {
+	clean := path.Clean(strings.ReplaceAll(file, `\`, "/"))
+	return file != "" && !path.IsAbs(clean) && clean != "." && clean != ".." && !strings.HasPrefix(clean, "../") && !strings.Contains(file, ":")
+}
+
+func (r *Release) validate(pkg, prefix string) error {
+	required := []struct {
+		field string
+		value string
+	}{
+		{"version", r.Version},
+		{"download", r.Download},
+	}
+	for _, f := range required {
+		if f.value == "" {
+			return &FieldError{Package: pkg, Field: prefix + f.field, Reason: "is missing"}
+		}
+	}
+	if r.Executeble == "" && len(r.Bin) == 0 {
+		return &FieldError{Package: pkg, Field: prefix + "executeble", Reason: "is missing"}
+	}
+	// the executeble is run and gets a shim, just like the bin paths
+	if r.Executeble != "" && !insidePackage(r.Executeble) {
+		return &FieldError{Package: pkg, Field: prefix + "executeble", Reason: fmt.Sprintf("'%s' must be a relative path inside the package", r.Executeble)}
+	}
+
+	// each version gets its own programs/<name>/<version> directory
+	if strings.ContainsAny(r.Version, `/\:`) || r.Version == "." || r.Version == ".." {
+		return &FieldError{Package: pkg, Field: prefix + "version", Reason: fmt.Sprintf("'%s' can't be used as a directory name", r.Version)}
+	}
+
+	// without an install type, it is detected from the downloaded file
+	if r.Install != "" && !installTypes[r.Install] {
+		return &FieldError{Package: pkg, Field: prefix + "install", Reason: fmt.Sprintf("has unknown install type '%s'", r.Install)}
+	}
+
+	if r.ExtractDir != "" || r.StripComponents != nil {
+		if r.Install != "" && (!archiveTypes[r.Install] || r.Install == "gzip") {
+			return &FieldError{Package: pkg, Field: prefix + "install", Reason: fmt.Sprintf("'%s' can't be used with extract_dir or strip_components", r.Install)}
+		}
+		if r.ExtractDir != "" && r.StripComponents != nil {
+			return &FieldError{Package: pkg, Field: prefix + "strip_components", Reason: "can't be used together with extract_dir"}
+		}
+	}
+	if dir := r.ExtractDir; dir != "" {
+		clean := path.Clean(strings.ReplaceAll(dir, `\`, "/"))
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(dir, ":") {
+			return &FieldError{Package: pkg, Field: prefix + "extract_dir", Reason: fmt.Sprintf("'%s' must be a relative path inside the archive", dir)}
+		}
+	}
+	if r.StripComponents != nil && *r.StripComponents < 0 {
+		return &FieldError{Package: pkg, Field: prefix + "strip_components", Reason: "can't be negative"}
+	}
+
+	// every command name must be unique, including the executeble's
+	commands := make(map[string]bool)
+	if bins := r.Bins(); len(bins) > len(r.Bin) {
+		commands[bins[0].Command()] = true
+	}
+	for i, bin := range r.Bin {
+		field := fmt.Sprintf("%sbin[%d]", prefix, i)
+		if !insidePackage(bin.Path) {
+			return &FieldError{Package: pkg, Field: field + ".path", Reason: fmt.Sprintf("'%s' must be a relative path inside the package", bin.Path)}
+		}
+		if bin.Name != "" && !namePattern.MatchString(bin.Name) {
+			return &FieldError{Package: pkg, Field: field + ".name", Reason: "may only contain letters, digits, '.', '_' and '-'"}
+		}
+		if commands[bin.Command()] {
+			return &FieldError{Package: pkg, Field: field, Reason: fmt.Sprintf("uses the command name '%s' twice", bin.Command())}
+		}
+		commands[bin.Command()] = true
+	}
+
+	if r.Hash != "" {
+		if _, err := parseChecksum(r.Hash); err != nil {
+			return &FieldError{Package: pkg, Field: prefix + "hash", Reason: err.Error()}
+		}
+	}
+
+	for i, dep := range r.Depends {
+		if _, err := parseDependency(dep); err != nil {
+			return &FieldError{Package: pkg, Field: fmt.Sprintf("%sdepends[%d]", prefix, i), Reason: err.Error()}
+		}
+	}
+	for i, name := range r.Provides {
+		if !namePattern.MatchString(name) || name == pkg {
+			return &FieldError{Package: pkg, Field: fmt.Sprintf("%sprovides[%d]", prefix, i), Reason: fmt.Sprintf("'%s' is not a valid virtual package name", name)}
+		}
+	}
+	for i, conflict := range r.Conflicts {
+		if _, err := parseDependency(conflict); err != nil {
+			return &FieldError{Package: pkg, Field: fmt.Sprintf("%sconflicts[%d]", prefix, i), Reason: err.Error()}
+		}
+	}
+
+	return nil
+}
+
+// inherit fills the fields a versions entry leaves out from the top-level
+// release. Download and hash are never inherited, they are per release.
+func (m *Manifest) inherit(release Release) Release {
+	if release.Install == "" {
+		release.Install = m.Install
+	}
+	if release.Executeble == "" {
+		release.Executeble = m.Executeble
+	}
+	if release.Depends == nil {
+		release.Depends = m.Depends
+	}
+	if release.Provides == nil {
+		release.Provides = m.Provides
+	}
+	if release.Conflicts == nil {
+		release.Conflicts = m.Conflicts
+	}
+	if release.Bin == nil {
+		release.Bin = m.Bin
+	}
+	if release.ExtractDir == "" && release.StripComponents == nil {
+		release.ExtractDir = m.ExtractDir
+		release.StripComponents = m.StripComponents
+	}
+	return release
+}
+
+// Releases returns every release of the package, newest first. The versions
+// list must already be normalized.
+func (m *Manifest) Releases() []Release {
+	var releases []Release
+	seen := make(map[string]bool)
+	add := func(release Release) {
+		if release.Version == "" || seen[release.Version] {
+			return
+		}
+		seen[release.Version] = true
+		releases = append(releases, release)
+	}
+
+	add(m.Release)
+	for _, release := range m.Versions {
+		add(release)
+	}
+
+	sort.SliceStable(releases, func(i, j int) bool {
+		return compareVersions(releases[i].Version, releases[j].Version) > 0
+	})
+	return releases
+}
+
+// normalize expands the versions list and points the top-level release at
+// the latest version, so code that only cares about the newest release can
+// keep reading the top-level fields
+func (m *Manifest) normalize() {
+	for i := range m.Versions {
+		m.Versions[i] = m.inherit(m.Versions[i])
+	}
+	m.Versions = m.Releases()
+	if latest, err := m.Resolve("latest"); err == nil {
+		m.Release = latest.Release
+	}
+}
+
+// Resolve picks the newest release matching a version constraint such as
+// "1.2.2", "^1.2", ">=1.0 <2" or "latest". The returned manifest describes
+// just that release.
+func (m *Manifest) Resolve(spec string) (*Manifest, error) {
+	constraint, err := parseConstraint(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	releases := m.Releases()
+	for _, release := range releases {
+		if constraint.Match(release.Version) {
+			return m.withRelease(release), nil
+		}
+	}
+
+	// "latest" falls back to a pre-release when there is nothing else
+	if constraint.Any() && len(releases) > 0 {
+		return m.withRelease(releases[0]), nil
+	}
+
+	var available []string
+	for _, release := range releases {
+		available = append(available, release.Version)
+	}
+	return nil, fmt.Errorf("no version of '%s' matches '%s' (available: %s)", m.Name, spec, strings.Join(available, ", "))
+}
+
+func (m *Manifest) withRelease(release Release) *Manifest {
+	resolved := *m
+	resolved.Release = release
+	resolved.Versions = nil
+	return &resolved
+}
+
+// decodeIndex decodes and validates a registry index. Unknown fields are
+// rejected so that misspelled keys don't get silently ignored.
+func decodeIndex(r io.Reader) (*Index, error) {
+	var index Index
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&index); err != nil {
+		return nil, fmt.Errorf("decoding package index: %w", err)
+	}
+
+	if err := checkSchema(index.Schema, indexSchemaVersion); err != nil {
+		return nil, err
+	}
+	index.Schema = indexSchemaVersion
+
+	if err := index.validate(); err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
+
+// decodeManifest decodes a single package manifest, as found in directory
+// registries
+func decodeManifest(r io.Reader) (*Manifest, error) {
+	var manifest Manifest
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("decoding package manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// validate checks every package and rejects duplicate names
+func (index *Index) validate() error {
+	seen := make(map[string]bool)
+	for i := range index.Packages {
+		pkg := &index.Packages[i]
+		if err := pkg.Validate(); err != nil {
+			return err
+		}
+		pkg.normalize()
+		if seen[pkg.Name] {
+			return &FieldError{Package: pkg.Name, Field: "name", Reason: "is used by more than one package"}
+		}
+		seen[pkg.Name] = true
+	}
+	return nil
+}
+
+// checkSchema rejects schema versions newer than this build understands.
+// A missing schema field is treated as version 1.
+func checkSchema(schema, newest int) error {
+	if schema > newest {
+		return fmt.Errorf("unsupported schema version %d (this BOOM understands up to %d), please update BOOM", schema, newest)
+	}
+	return nil
+}
+
+// Find returns the package with the given name
+func (index *Index) Find(name string) (*Manifest, bool) {
+	for i := range index.Packages {
+		if index.Packages[i].Name == name {
+			return &index.Packages[i], true
+		}
+	}
+	return nil, false
+}
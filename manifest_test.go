@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReleaseValidatePaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		release Release
+		field   string // the field that is rejected, "" when the release is valid
+	}{
+		{"executeble", Release{Executeble: "bin/tool.exe"}, ""},
+		{"executeble with backslashes", Release{Executeble: `bin\tool.exe`}, ""},
+		{"executeble outside", Release{Executeble: "../../../../bin/sh"}, "executeble"},
+		{"executeble outside with backslashes", Release{Executeble: `..\..\tool.exe`}, "executeble"},
+		{"absolute executeble", Release{Executeble: "/bin/sh"}, "executeble"},
+		{"executeble with a drive", Release{Executeble: `C:\Windows\cmd.exe`}, "executeble"},
+		{"bin", Release{Executeble: "tool", Bin: []Bin{{Path: "bin/other"}}}, ""},
+		{"bin outside", Release{Bin: []Bin{{Path: "bin/../../other"}}}, "bin[0].path"},
+		{"bin without a path", Release{Bin: []Bin{{Name: "x"}}}, "bin[0].path"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			release := test.release
+			release.Version = "1.0"
+			release.Download = "https://example.com/tool.zip"
+			err := release.validate("tool", "")
+			if test.field == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "'"+test.field+"'") {
+				t.Fatalf("got error %v, want %s to be rejected", err, test.field)
+			}
+		})
+	}
+}
+
+func TestShimsSkipPathsOutsideThePackage(t *testing.T) {
+	testHome(t, "")
+	db := &InstalledDB{Packages: []InstalledPackage{
+		{Manifest: Manifest{Name: "evil", Release: Release{Version: "1.0", Executeble: "../../../../bin/sh"}}},
+		{Manifest: Manifest{Name: "tool", Release: Release{Version: "1.0", Executeble: "tool.exe"}}},
+	}}
+
+	shims, _ := db.Shims()
+	if len(shims) != 1 || shims[0].Name != "tool" {
+		t.Fatalf("got shims %v, want only tool", shims)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// OutdatedPackage is one row of the `boom outdated` report
+type OutdatedPackage struct {
+	Name      string `json:"name"`
+	Installed string `json:"installed"`
+	Available string `json:"available"`
+	Registry  string `json:"registry"`
+	Held      bool   `json:"held"`
+}
+
+// outdated reports installed packages that have a newer registry version.
+// It exits with status 1 when any package that isn't held has one, and 2
+// when the check fails, so CI can fail on drift.
+func outdated() {
+	args := parseArgs(os.Args[2:])
+
+	packages, err := findOutdated(IndexOptions{Insecure: true, Offline: args.Bool("offline")})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(2)
+	}
+
+	if args.Bool("json") {
+		jsonContent, err := json.MarshalIndent(packages, "", "    ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(2)
+		}
+		fmt.Println(string(jsonContent))
+	} else if len(packages) == 0 {
+		fmt.Println("All packages are up to date.")
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Name\tInstalled\tAvailable\tRegistry\tStatus")
+		for _, pkg := range packages {
+			status := ""
+			if pkg.Held {
+				status = "held"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", pkg.Name, pkg.Installed, pkg.Available, pkg.Registry, status)
+		}
+		w.Flush()
+	}
+
+	for _, pkg := range packages {
+		if !pkg.Held {
+			os.Exit(1)
+		}
+	}
+}
+
+// findOutdated compares every installed package with the merged index
+func findOutdated(opts IndexOptions) ([]OutdatedPackage, error) {
+	installed, err := loadInstalled()
+	if err != nil {
+		return nil, err
+	}
+	packages := []OutdatedPackage{}
+	if len(installed.Packages) == 0 {
+		return packages, nil
+	}
+
+	index, err := loadIndex(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range installed.Packages {
+		record := &installed.Packages[i]
+		entry, ok := availableUpdate(index, record)
+		if !ok {
+			continue
+		}
+		packages = append(packages, OutdatedPackage{
+			Name:      record.Name,
+			Installed: record.Version,
+			Available: entry.Version,
+			Registry:  entry.Registry,
+			Held:      record.Held,
+		})
+	}
+	return packages, nil
+}
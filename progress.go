@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// progressLines shows one line per download, one below the other. On a
+// terminal the lines are redrawn in place as the bars move; otherwise bars
+// are hidden and only status messages are printed, which keeps CI logs
+// readable.
+type progressLines struct {
+	mu       sync.Mutex
+	terminal bool
+	width    int
+	lines    []string
+	drawn    int
+}
+
+func newProgressLines() *progressLines {
+	info, err := os.Stdout.Stat()
+	return &progressLines{terminal: err == nil && info.Mode()&os.ModeCharDevice != 0}
+}
+
+// Line adds a line for a download. Add every line before the downloads
+// start, so the labels can be lined up.
+func (p *progressLines) Line(label string) *progressLine {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.width = max(p.width, len(label))
+	p.lines = append(p.lines, "")
+	return &progressLine{lines: p, index: len(p.lines) - 1, label: label}
+}
+
+func (p *progressLines) set(index int, text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lines[index] = text
+
+	// move back up over what was drawn before and draw every line again
+	if p.drawn > 0 {
+		fmt.Printf("\033[%dA", p.drawn)
+	}
+	for _, line := range p.lines {
+		fmt.Printf("\r\033[K%s\n", line)
+	}
+	p.drawn = len(p.lines)
+}
+
+// progressLine is the line of one download
+type progressLine struct {
+	lines *progressLines
+	index int
+	label string
+}
+
+func (l *progressLine) prefix() string {
+	return fmt.Sprintf("%-*s  ", l.lines.width, l.label)
+}
+
+// Bar returns a progress bar drawn on this line, replacing what was there
+func (l *progressLine) Bar(total int64) *progressbar.ProgressBar {
+	return progressbar.NewOptions64(
+		total,
+		progressbar.OptionSetVisibility(l.lines.terminal),
+		progressbar.OptionSetWriter(l),
+		progressbar.OptionSetRenderBlankState(true),
+		progressbar.OptionSetWidth(30),
+		progressbar.OptionThrottle(65*time.Millisecond),
+		progressbar.OptionSetDescription(l.prefix()),
+	)
+}
+
+// Set replaces the line with a status message
+func (l *progressLine) Set(format string, a ...any) {
+	text := l.prefix() + fmt.Sprintf(format, a...)
+	if !l.lines.terminal {
+		l.lines.mu.Lock()
+		fmt.Println(text)
+		l.lines.mu.Unlock()
+		return
+	}
+	l.lines.set(l.index, text)
+}
+
+// Write receives what the progress bar renders. Each frame starts with a
+// carriage return; frames that only clear the line are dropped, as the
+// next frame replaces the whole line anyway.
+func (l *progressLine) Write(p []byte) (int, error) {
+	text := string(p)
+	if i := strings.LastIndex(text, "\r"); i >= 0 {
+		text = text[i+1:]
+	}
+	if strings.TrimSpace(text) != "" {
+		l.lines.set(l.index, text)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// IndexEntry is a package manifest together with the registry it came from
+type IndexEntry struct {
+	Manifest
+	Registry string
+}
+
+// MergedIndex holds the packages of every configured registry, in registry
+// priority order
+type MergedIndex struct {
+	Entries []IndexEntry
+	// Registries names every configured registry in priority order
+	Registries []string
+	// Skipped names the registries that couldn't be loaded
+	Skipped []string
+}
+
+func registryCommand() {
+	args := parseArgs(os.Args[2:], "priority")
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	switch args.Arg(0) {
+	case "add":
+		if len(args.Positional) < 3 {
+			fmt.Println("Usage: boom registry add <name> <url|path> [--priority <n>]")
+			return
+		}
+		name, source := args.Arg(1), args.Arg(2)
+		if _, exists := config.Registry(name); exists {
+			fmt.Printf("Registry '%s' already exists.\n", name)
+			return
+		}
+		if err := checkRegistryName(name); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		source, err := normalizeRegistrySource(source)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+
+		// --priority 1 is the highest; without it the registry goes last
+		position := len(config.Registries)
+		if value, ok := args.Flags["priority"]; ok {
+			priority, err := strconv.Atoi(value)
+			if err != nil || priority < 1 {
+				fmt.Println("Error: --priority must be a number starting from 1")
+				return
+			}
+			position = min(priority-1, len(config.Registries))
+		}
+		registry := RegistryConfig{Name: name, URL: source}
+		config.Registries = append(config.Registries[:position], append([]RegistryConfig{registry}, config.Registries[position:]...)...)
+
+		if err := config.save(); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Printf("Registry '%s' added.\n", name)
+	case "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Priority\tName\tURL")
+		for i, registry := range config.Registries {
+			fmt.Fprintf(w, "%d\t%s\t%s\n", i+1, registry.Name, registry.URL)
+		}
+		w.Flush()
+	case "remove":
+		if len(args.Positional) < 2 {
+			fmt.Println("Usage: boom registry remove <name>")
+			return
+		}
+		name := args.Arg(1)
+		removed := false
+		for i, registry := range config.Registries {
+			if registry.Name == name {
+				config.Registries = append(config.Registries[:i], config.Registries[i+1:]...)
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			fmt.Printf("Registry '%s' not found.\n", name)
+			return
+		}
+		if err := config.save(); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		removeIndexCache(name)
+		fmt.Printf("Registry '%s' removed.\n", name)
+	default:
+		fmt.Println("Usage: boom registry <add|list|remove> [arguments]")
+	}
+}
+
+// checkRegistryName rejects names that can't be used in "registry/package"
+func checkRegistryName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid registry name '%s'", name)
+	}
+	return nil
+}
+
+// normalizeRegistrySource checks that a registry source is an http(s) URL,
+// a file:// URL or an existing local path, and makes local paths absolute
+func normalizeRegistrySource(source string) (string, error) {
+	path, ok := localPath(source)
+	if !ok {
+		if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+			return "", fmt.Errorf("registry must be an http(s) URL, a file:// URL or a local path, got '%s'", source)
+		}
+		return source, nil
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(source, "file://") {
+		return source, nil
+	}
+	return filepath.Abs(path)
+}
+
+// loadIndex fetches every configured registry and merges them in priority
+// order. A registry that can't be loaded, say one that is unreachable and
+// not cached, is skipped with a warning; it only fails when no registry can
+// be loaded at all.
+func loadIndex(opts IndexOptions) (*MergedIndex, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Registries) == 0 {
+		return nil, fmt.Errorf("no registries configured, add one with 'boom registry add'")
+	}
+
+	merged := &MergedIndex{}
+	for _, registry := range config.Registries {
+		merged.Registries = append(merged.Registries, registry.Name)
+		index, err := fetchIndex(registry, opts)
+		if err != nil {
+			if len(config.Registries) == 1 {
+				return nil, fmt.Errorf("registry '%s': %w", registry.Name, err)
+			}
+			fmt.Fprintf(os.Stderr, "Warning: skipping registry '%s': %s\n", registry.Name, err)
+			merged.Skipped = append(merged.Skipped, registry.Name)
+			continue
+		}
+		for _, pkg := range index.Packages {
+			merged.Entries = append(merged.Entries, IndexEntry{Manifest: pkg, Registry: registry.Name})
+		}
+	}
+	if len(merged.Skipped) == len(config.Registries) {
+		return nil, fmt.Errorf("no registry could be loaded")
+	}
+	return merged, nil
+}
+
+// skippedNote explains a package that wasn't found by the registries that
+// couldn't be searched
+func (mi *MergedIndex) skippedNote() string {
+	if len(mi.Skipped) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%s could not be loaded)", quoteNames(mi.Skipped))
+}
+
+// checkShadowed fails when entry was found for a bare package name, but a
+// registry of higher priority that couldn't be loaded may have the package
+// too. Installing from the lower one would silently swap the package, say a
+// company's own build for a public one of the same name.
+func (mi *MergedIndex) checkShadowed(ref string, entry *IndexEntry) error {
+	if strings.Contains(ref, "/") {
+		return nil
+	}
+	for _, registry := range mi.Registries {
+		if registry == entry.Registry {
+			return nil
+		}
+		if slices.Contains(mi.Skipped, registry) {
+			return fmt.Errorf("registry '%s' could not be loaded and comes before '%s', which has '%s'; install '%s/%s' to use that one",
+				registry, entry.Registry, ref, entry.Registry, entry.Name)
+		}
+	}
+	return nil
+}
+
+// Find resolves "package" to the highest priority registry that has it, or
+// "registry/package" to that specific registry
+func (mi *MergedIndex) Find(ref string) (*IndexEntry, bool) {
+	registry, name, explicit := strings.Cut(ref, "/")
+	if !explicit {
+		name = registry
+	}
+
+	for i := range mi.Entries {
+		entry := &mi.Entries[i]
+		if entry.Name == name && (!explicit || entry.Registry == registry) {
+			return entry, true
+		}
+	}
+	return nil, false
+}
+
+// FindProvider returns the highest priority package that provides the
+// virtual name
+func (mi *MergedIndex) FindProvider(name string) (*IndexEntry, bool) {
+	for i := range mi.Entries {
+		entry := &mi.Entries[i]
+		if entry.ProvidesName(entry.Name, name) {
+			return entry, true
+		}
+	}
+	return nil, false
+}
+
+// Resolve picks the release matching a version constraint, see
+// Manifest.Resolve
+func (e *IndexEntry) Resolve(spec string) (*IndexEntry, error) {
+	resolved, err := e.Manifest.Resolve(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &IndexEntry{Manifest: *resolved, Registry: e.Registry}, nil
+}
+
+// fetchIndex reads a registry index, checks its detached signature
+// (<url>.sig) against the trust store and decodes it. Remote indexes go
+// through the on-disk cache; local ones are always read directly.
+func fetchIndex(registry RegistryConfig, opts IndexOptions) (*Index, error) {
+	index, err := readIndex(registry, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := index.resolveDownloads(registry); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func readIndex(registry RegistryConfig, opts IndexOptions) (*Index, error) {
+	path, local := localPath(registry.URL)
+	if local {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return readDirectoryIndex(registry, path, opts.Insecure)
+		}
+	}
+
+	var data, signature []byte
+	var err error
+	if local {
+		data, err = readSource(registry.URL)
+		if err == nil {
+			signature, err = readSignature(registry.URL)
+		}
+	} else {
+		data, signature, err = fetchRemoteIndex(registry, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkIndexSignature(registry, data, signature, opts.Insecure); err != nil {
+		return nil, err
+	}
+
+	return decodeIndex(bytes.NewReader(data))
+}
+
+// resolveDownloads checks where the releases of a registry download from.
+// Remote registries may only use http(s) URLs, so an index can't make BOOM
+// copy files from this machine. Local registries may also use file: URLs,
+// which are made absolute: file:tools/x.zip is relative to the registry's
+// directory.
+func (index *Index) resolveDownloads(registry RegistryConfig) error {
+	registryPath, local := localPath(registry.URL)
+	if local {
+		if info, err := os.Stat(registryPath); err != nil || !info.IsDir() {
+			registryPath = filepath.Dir(registryPath)
+		}
+	}
+
+	resolve := func(pkg string, release *Release) error {
+		download := release.Download
+		if download == "" || strings.HasPrefix(download, "http://") || strings.HasPrefix(download, "https://") {
+			return nil
+		}
+		if !local {
+			return &FieldError{Package: pkg, Field: "download", Reason: fmt.Sprintf("'%s' must be an http(s) URL in a remote registry", download)}
+		}
+
+		u, err := url.Parse(download)
+		if err != nil || u.Scheme != "file" {
+			return &FieldError{Package: pkg, Field: "download", Reason: fmt.Sprintf("'%s' must be an http(s) or file: URL", download)}
+		}
+		var path string
+		if u.Opaque != "" {
+			// file:relative/path has no slashes after the colon
+			opaque, err := url.PathUnescape(u.Opaque)
+			if err != nil {
+				return &FieldError{Package: pkg, Field: "download", Reason: err.Error()}
+			}
+			path = filepath.Join(registryPath, filepath.FromSlash(opaque))
+		} else {
+			path, _ = localPath(download)
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(registryPath, path)
+			}
+		}
+		release.Download = fileURL(path)
+		return nil
+	}
+
+	for i := range index.Packages {
+		pkg := &index.Packages[i]
+		if err := resolve(pkg.Name, &pkg.Release); err != nil {
+			return err
+		}
+		for j := range pkg.Versions {
+			if err := resolve(pkg.Name, &pkg.Versions[j]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readDirectoryIndex builds an index from a directory holding one
+// <package>.json manifest per package, each signed by its own .sig file
+func readDirectoryIndex(registry RegistryConfig, dir string, insecure bool) (*Index, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	index := &Index{Schema: indexSchemaVersion}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		signature, err := readSignature(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkIndexSignature(registry, data, signature, insecure); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+		manifest, err := decodeManifest(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+		index.Packages = append(index.Packages, *manifest)
+	}
+
+	if err := index.validate(); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// readSignature reads the detached signature <source>.sig, returning nil
+// when there is none
+func readSignature(source string) ([]byte, error) {
+	signature, err := readSource(source + ".sig")
+	if errors.Is(err, errNotFound) {
+		return nil, nil
+	}
+	return signature, err
+}
+
+// checkIndexSignature verifies data against its detached signature. With
+// insecure set, a missing or bad signature only prints a warning.
+func checkIndexSignature(registry RegistryConfig, data, signature []byte, insecure bool) error {
+	if _, err := verifySignature(data, signature); err != nil {
+		if !insecure {
+			return fmt.Errorf("%w (use --insecure to install anyway)", err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: registry '%s': %s\n", registry.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testRegistry writes a local directory registry holding the given
+// <package>.json manifests and returns its path
+func testRegistry(t *testing.T, manifests map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, manifest := range manifests {
+		if err := os.WriteFile(filepath.Join(dir, name+".json"), []byte(manifest), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// testRegistries points config.json at the registries, in priority order,
+// and loads them. The test registries are unsigned.
+func testRegistries(t *testing.T, registries ...RegistryConfig) (*MergedIndex, error) {
+	t.Helper()
+	config, err := json.Marshal(&Config{Registries: registries})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testHome(t, string(config))
+	return loadIndex(IndexOptions{Insecure: true})
+}
+
+const (
+	toolManifest = `{"name": "tool", "version": "1.0", "download": "https://example.com/tool.exe", "install": "exe", "executeble": "tool.exe"}`
+	appManifest  = `{"name": "app", "version": "1.0", "download": "https://example.com/app.exe", "install": "exe", "executeble": "app.exe", "depends": ["tool"]}`
+)
+
+func TestLoadIndexSkipsBrokenRegistry(t *testing.T) {
+	good := testRegistry(t, map[string]string{"tool": toolManifest, "app": appManifest})
+	missing := filepath.Join(t.TempDir(), "missing.json")
+
+	index, err := testRegistries(t,
+		RegistryConfig{Name: "corp", URL: missing},
+		RegistryConfig{Name: "public", URL: good},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Skipped) != 1 || index.Skipped[0] != "corp" {
+		t.Fatalf("skipped %q, want corp", index.Skipped)
+	}
+
+	entry, ok := index.Find("tool")
+	if !ok {
+		t.Fatal("tool not found in the registry that loaded")
+	}
+	// corp may have its own tool, so a bare name must not fall through
+	if err := index.checkShadowed("tool", entry); err == nil || !strings.Contains(err.Error(), "'corp' could not be loaded") {
+		t.Fatalf("got error %v, want corp to shadow tool", err)
+	}
+	if err := index.checkShadowed("public/tool", entry); err != nil {
+		t.Fatalf("public/tool: %v", err)
+	}
+
+	// the same goes for dependencies
+	app, _ := index.Find("public/app")
+	if _, err := resolvePlan(index, &InstalledDB{}, []*IndexEntry{app}); err == nil || !strings.Contains(err.Error(), "'corp' could not be loaded") {
+		t.Fatalf("got error %v, want the tool dependency to be shadowed", err)
+	}
+}
+
+func TestLoadIndexSkipsLowerRegistry(t *testing.T) {
+	good := testRegistry(t, map[string]string{"tool": toolManifest, "app": appManifest})
+
+	index, err := testRegistries(t,
+		RegistryConfig{Name: "public", URL: good},
+		RegistryConfig{Name: "mirror", URL: filepath.Join(t.TempDir(), "missing.json")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, _ := index.Find("app")
+	if err := index.checkShadowed("app", app); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := resolvePlan(index, &InstalledDB{}, []*IndexEntry{app})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 2 || plan[0].Name != "tool" || plan[1].Name != "app" {
+		t.Fatalf("planned %v, want tool then app", planNames(plan))
+	}
+}
+
+func TestLoadIndexFailsWithoutRegistries(t *testing.T) {
+	_, err := testRegistries(t,
+		RegistryConfig{Name: "a", URL: filepath.Join(t.TempDir(), "a.json")},
+		RegistryConfig{Name: "b", URL: filepath.Join(t.TempDir(), "b.json")},
+	)
+	if err == nil {
+		t.Fatal("loading only broken registries succeeded")
+	}
+}
+
+func TestResolveDownloads(t *testing.T) {
+	manifest := func(download string) string {
+		return `{"name": "tool", "version": "1.0", "download": "` + download + `", "install": "exe", "executeble": "tool.exe"}`
+	}
+	tests := []struct {
+		name     string
+		download string
+		want     string // the download URL after loading, "" when the registry is refused
+	}{
+		{"https", "https://example.com/tool.exe", "https://example.com/tool.exe"},
+		{"relative file", "file:art/tool.exe", "art/tool.exe"},
+		{"absolute file", "file:///opt/tool.exe", "/opt/tool.exe"},
+		{"plain path", "/etc/passwd", ""},
+		{"other scheme", "ftp://example.com/tool.exe", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := testRegistry(t, map[string]string{"tool": manifest(test.download)})
+			index, err := testRegistries(t, RegistryConfig{Name: "local", URL: dir})
+			if test.want == "" {
+				if err == nil {
+					t.Fatal("registry with an invalid download loaded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := test.want
+			if !strings.Contains(want, "://") {
+				if !filepath.IsAbs(want) {
+					want = filepath.Join(dir, want)
+				}
+				want = fileURL(want)
+			}
+			if entry, _ := index.Find("tool"); entry.Download != want {
+				t.Fatalf("download is %s, want %s", entry.Download, want)
+			}
+		})
+	}
+}
+
+func planNames(plan []*IndexEntry) []string {
+	var names []string
+	for _, entry := range plan {
+		names = append(names, entry.Name)
+	}
+	return names
+}
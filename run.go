@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
+)
+
+// run starts a program of an installed package and returns the exit code
+// boom should exit with: the program's own, or 1 when it couldn't be started.
+// Messages go to stderr so the program's output can be captured as is.
+func run() int {
+	// flags before the package name are boom's, everything after it belongs
+	// to the program
+	args := os.Args[2:]
+	verbose := false
+	for len(args) > 0 && args[0] == "--verbose" {
+		verbose = true
+		args = args[1:]
+	}
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: boom run [--verbose] <package> [bin] [arguments]")
+		return 1
+	}
+	package_name, args := args[0], args[1:]
+
+	installed, err := loadInstalled()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	program := installed.Find(package_name)
+	if program == nil {
+		fmt.Fprintf(os.Stderr, "Error: package '%s' is not installed.\n", package_name)
+		return 1
+	}
+
+	// the second argument picks one of the package's programs when it names
+	// one, otherwise it is passed to the main program
+	bin := program.Bins()[0]
+	if len(args) > 0 {
+		if found, ok := program.FindBin(args[0]); ok {
+			bin, args = found, args[1:]
+		}
+	}
+
+	if !insidePackage(bin.Path) {
+		fmt.Fprintf(os.Stderr, "Error: '%s' of package '%s' points outside the package (%s), reinstall the package.\n", bin.Command(), program.Name, bin.Path)
+		return 1
+	}
+
+	// goto the directory of the current version and run the program in the directory
+	executablePath := filepath.Join(program.Dir(), filepath.FromSlash(bin.Path))
+	if _, err := os.Stat(executablePath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: '%s' of package '%s' %s is not installed (%s is missing), reinstall the package.\n", bin.Command(), program.Name, program.Version, executablePath)
+		return 1
+	}
+
+	cmd := exec.Command(executablePath, append(slices.Clone(bin.Args), args...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if verbose {
+		fmt.Fprintln(os.Stderr, "Executing command:", cmd.String())
+	}
+
+	// boom keeps running until the program exits, and passes on SIGINT and
+	// SIGTERM sent to it, say by kill or a CI runner cancelling a job. After
+	// Ctrl-C in a terminal the program sees SIGINT twice, once from the
+	// terminal and once from boom, which almost every program treats like one.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	go func() {
+		for sig := range signals {
+			cmd.Process.Signal(sig)
+		}
+	}()
+
+	err = cmd.Wait()
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		// like a shell, a program killed by a signal exits with 128 + signal
+		if status, ok := exitError.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return exitError.ExitCode()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
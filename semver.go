@@ -0,0 +1,233 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// compareVersions compares two version strings and returns -1, 0 or 1.
+//
+// Semantic versions ("1.2.3", "v2.0.0-rc.1+build") are ordered as semver
+// specifies. Anything else falls back to the same rules applied loosely:
+// dot separated parts are compared numerically when both are numbers and
+// as text otherwise, and missing parts count as 0, so "0.12" > "0.9" and
+// "1.2" == "1.2.0".
+func compareVersions(a, b string) int {
+	aRelease, aPre := splitVersion(a)
+	bRelease, bPre := splitVersion(b)
+
+	if c := compareParts(aRelease, bRelease, true); c != 0 {
+		return c
+	}
+
+	// a version without a pre-release suffix is newer than one with it
+	switch {
+	case aPre == nil && bPre == nil:
+		return 0
+	case aPre == nil:
+		return 1
+	case bPre == nil:
+		return -1
+	}
+	return compareParts(aPre, bPre, false)
+}
+
+// splitVersion strips a leading "v" and build metadata and returns the
+// release and pre-release identifiers
+func splitVersion(version string) (release, pre []string) {
+	version = strings.TrimSpace(version)
+	version = strings.TrimPrefix(strings.TrimPrefix(version, "v"), "V")
+	version, _, _ = strings.Cut(version, "+")
+
+	releasePart, prePart, hasPre := strings.Cut(version, "-")
+	release = strings.Split(releasePart, ".")
+	if hasPre {
+		pre = strings.Split(prePart, ".")
+	}
+	return release, pre
+}
+
+// compareParts compares identifier lists. Release parts pad missing entries
+// with 0; pre-release lists follow semver, where the shorter list is older.
+func compareParts(a, b []string, padZero bool) int {
+	for i := 0; i < max(len(a), len(b)); i++ {
+		if i >= len(a) || i >= len(b) {
+			if padZero {
+				var part string
+				if i < len(a) {
+					part = a[i]
+				} else {
+					part = b[i]
+				}
+				if n, err := strconv.Atoi(part); err == nil && n == 0 {
+					continue
+				}
+			}
+			if i >= len(a) {
+				return -1
+			}
+			return 1
+		}
+		if c := compareIdentifier(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareIdentifier compares numerically when both identifiers are numbers.
+// Numbers sort before text, as in semver pre-release identifiers.
+func compareIdentifier(a, b string) int {
+	aNum, aErr := strconv.Atoi(a)
+	bNum, bErr := strconv.Atoi(b)
+	switch {
+	case aErr == nil && bErr == nil:
+		return cmp.Compare(aNum, bNum)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// Constraint is a parsed version requirement such as "^1.2", "~0.12",
+// ">=1.0 <2.0", "1.2.2" or "latest". Space or comma separated checks must
+// all match.
+type Constraint struct {
+	raw    string
+	checks []versionCheck
+	// pre-releases only match constraints that mention one themselves
+	allowPre bool
+}
+
+type versionCheck struct {
+	op      string
+	version string
+}
+
+func parseConstraint(spec string) (*Constraint, error) {
+	spec = strings.TrimSpace(spec)
+	constraint := &Constraint{raw: spec, allowPre: strings.Contains(spec, "-")}
+	if spec == "" || spec == "latest" || spec == "*" {
+		return constraint, nil
+	}
+
+	for _, field := range strings.FieldsFunc(spec, func(r rune) bool { return r == ' ' || r == ',' }) {
+		checks, err := parseCheck(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint '%s': %w", spec, err)
+		}
+		constraint.checks = append(constraint.checks, checks...)
+	}
+	return constraint, nil
+}
+
+// parseCheck turns one operator and version into comparisons. ^ and ~ expand
+// into a lower and an upper bound.
+func parseCheck(field string) ([]versionCheck, error) {
+	for _, op := range []string{">=", "<=", "==", ">", "<", "=", "^", "~"} {
+		if !strings.HasPrefix(field, op) {
+			continue
+		}
+		version := field[len(op):]
+		if !looksLikeVersion(version) {
+			return nil, fmt.Errorf("'%s' is not a version", version)
+		}
+
+		switch op {
+		case "^", "~":
+			upper, err := upperBound(version, op == "^")
+			if err != nil {
+				return nil, err
+			}
+			return []versionCheck{{">=", version}, {"<", upper}}, nil
+		case "==":
+			op = "="
+		}
+		return []versionCheck{{op, version}}, nil
+	}
+
+	if !looksLikeVersion(field) {
+		return nil, fmt.Errorf("'%s' is not a version", field)
+	}
+	return []versionCheck{{"=", field}}, nil
+}
+
+func looksLikeVersion(version string) bool {
+	version = strings.TrimPrefix(strings.TrimPrefix(version, "v"), "V")
+	return version != "" && version[0] >= '0' && version[0] <= '9'
+}
+
+// upperBound returns the exclusive upper bound of a caret or tilde range:
+// ^1.2.3 -> 2, ^0.12 -> 0.13, ^0.0.3 -> 0.0.4, ~1.2.3 -> 1.3, ~1 -> 2
+func upperBound(version string, caret bool) (string, error) {
+	release, _ := splitVersion(version)
+	parts := make([]int, len(release))
+	for i, part := range release {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return "", fmt.Errorf("'%s' is not numeric, ranges need numeric versions", version)
+		}
+		parts[i] = n
+	}
+
+	bump := 0
+	if caret {
+		// the first non-zero part may not change
+		for bump < len(parts)-1 && parts[bump] == 0 {
+			bump++
+		}
+	} else if len(parts) > 1 {
+		bump = 1
+	}
+
+	upper := make([]string, bump+1)
+	for i := 0; i < bump; i++ {
+		upper[i] = strconv.Itoa(parts[i])
+	}
+	upper[bump] = strconv.Itoa(parts[bump] + 1)
+	return strings.Join(upper, "."), nil
+}
+
+// Match reports whether a version satisfies the constraint
+func (c *Constraint) Match(version string) bool {
+	if _, pre := splitVersion(version); pre != nil && !c.allowPre {
+		return false
+	}
+
+	for _, check := range c.checks {
+		result := compareVersions(version, check.version)
+		var ok bool
+		switch check.op {
+		case "=":
+			ok = result == 0
+		case ">":
+			ok = result > 0
+		case ">=":
+			ok = result >= 0
+		case "<":
+			ok = result < 0
+		case "<=":
+			ok = result <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Any reports whether the constraint accepts every version
+func (c *Constraint) Any() bool {
+	return len(c.checks) == 0
+}
+
+func (c *Constraint) String() string {
+	if c.raw == "" {
+		return "latest"
+	}
+	return c.raw
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2.10", "1.2.9", 1},
+		{"1.10", "1.9.9", 1},
+		{"1.2", "1.2.0", 0},
+		{"1.2.1", "1.2", 1},
+		{"v2.0.0", "2.0.0", 0},
+		{"1.0.0+build.5", "1.0.0", 0},
+		// non-semver versions such as SpeedCrunch's
+		{"0.12", "0.9", 1},
+		{"0.12", "0.12.0.0", 0},
+		// pre-releases sort before their release, as semver orders them
+		{"1.0.0-rc.1", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-rc.1", "0.9.9", 1},
+	}
+
+	for _, test := range tests {
+		if got := compareVersions(test.a, test.b); got != test.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+		if got := compareVersions(test.b, test.a); got != -test.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", test.b, test.a, got, -test.want)
+		}
+	}
+}
+
+func TestUpperBound(t *testing.T) {
+	tests := []struct {
+		version string
+		caret   bool
+		want    string
+	}{
+		{"1.2.3", true, "2"},
+		{"0.12", true, "0.13"},
+		{"0.0.3", true, "0.0.4"},
+		{"0", true, "1"},
+		{"1.2.3", false, "1.3"},
+		{"0.12", false, "0.13"},
+		{"1", false, "2"},
+	}
+
+	for _, test := range tests {
+		got, err := upperBound(test.version, test.caret)
+		if err != nil || got != test.want {
+			t.Errorf("upperBound(%q, %v) = %q, %v, want %q", test.version, test.caret, got, err, test.want)
+		}
+	}
+
+	if _, err := upperBound("1.x", true); err == nil {
+		t.Error("upperBound accepted a non-numeric version")
+	}
+}
+
+func TestConstraintMatch(t *testing.T) {
+	tests := []struct {
+		spec     string
+		versions map[string]bool
+	}{
+		{"^1.2", map[string]bool{"1.2.0": true, "1.9.9": true, "2.0.0": false, "1.1": false, "1.3.0-rc.1": false}},
+		{"^0.12", map[string]bool{"0.12": true, "0.12.4": true, "0.13": false}},
+		{"~1.2.3", map[string]bool{"1.2.3": true, "1.2.9": true, "1.3.0": false, "1.2.2": false}},
+		{">=1.0 <2.0", map[string]bool{"1.0": true, "1.5": true, "2.0": false, "0.9": false}},
+		{">=1.0,<2.0", map[string]bool{"1.5": true, "2.0": false}},
+		{"1.2.2", map[string]bool{"1.2.2": true, "v1.2.2": true, "1.2.3": false}},
+		{"==1.2.2", map[string]bool{"1.2.2": true, "1.2.3": false}},
+		{"0.12", map[string]bool{"0.12.0": true, "0.12.1": false}},
+		{"latest", map[string]bool{"0.1": true, "99": true, "2.0.0-rc.1": false}},
+		{"", map[string]bool{"1.0": true}},
+		// a constraint that names a pre-release accepts them
+		{">=2.0.0-rc.1", map[string]bool{"2.0.0-rc.2": true, "2.0.0": true, "2.0.0-beta": false}},
+	}
+
+	for _, test := range tests {
+		constraint, err := parseConstraint(test.spec)
+		if err != nil {
+			t.Errorf("parseConstraint(%q): %v", test.spec, err)
+			continue
+		}
+		for version, want := range test.versions {
+			if got := constraint.Match(version); got != want {
+				t.Errorf("%q matches %q: %v, want %v", test.spec, version, got, want)
+			}
+		}
+	}
+}
+
+func TestParseConstraintRejects(t *testing.T) {
+	for _, spec := range []string{"foo", ">=", "^abc", "^1.x", ">=1.0 <two"} {
+		if _, err := parseConstraint(spec); err == nil || !strings.Contains(err.Error(), "invalid version constraint") {
+			t.Errorf("parseConstraint(%q) = %v, want an invalid constraint error", spec, err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// shimsDir holds a launcher for every program of the installed packages, so
+// they can be run by name once the directory is on PATH
+func shimsDir() string {
+	return filepath.Join(currentUser.HomeDir, ".boom", "shims")
+}
+
+// Shim is a launcher in the shims directory that starts a program of the
+// current version of a package
+type Shim struct {
+	Name    string
+	Package string
+	Target  string
+	Args    []string
+}
+
+// commandName is the name a program is run by: its file name without an
+// executable or script extension such as ".exe" or ".sh"
+func commandName(executable string) string {
+	name := filepath.Base(filepath.FromSlash(executable))
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".exe", ".bat", ".cmd", ".com", ".sh":
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return name
+}
+
+// Shims returns the launchers for the installed packages, sorted by name.
+// When two programs have the same name, the one in the package that sorts
+// first gets the shim and the other is returned in shadowed.
+func (db *InstalledDB) Shims() (shims []Shim, shadowed []Shim) {
+	packages := make([]*InstalledPackage, len(db.Packages))
+	for i := range db.Packages {
+		packages[i] = &db.Packages[i]
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		return packages[i].Name < packages[j].Name
+	})
+
+	seen := make(map[string]bool)
+	for _, pkg := range packages {
+		for _, bin := range pkg.Bins() {
+			shim := Shim{
+				Name:    bin.Command(),
+				Package: pkg.Name,
+				Target:  filepath.Join(pkg.Dir(), filepath.FromSlash(bin.Path)),
+				Args:    bin.Args,
+			}
+			// records installed before paths were checked may point anywhere
+			if !namePattern.MatchString(shim.Name) || !insidePackage(bin.Path) {
+				continue
+			}
+			if seen[strings.ToLower(shim.Name)] {
+				shadowed = append(shadowed, shim)
+				continue
+			}
+			seen[strings.ToLower(shim.Name)] = true
+			shims = append(shims, shim)
+		}
+	}
+
+	sort.Slice(shims, func(i, j int) bool {
+		return shims[i].Name < shims[j].Name
+	})
+	return shims, shadowed
+}
+
+// writeShims makes the shims directory match installed.json: a shim for
+// every installed program, pointing at its current version, and nothing
+// else. It returns the shims written.
+func writeShims(db *InstalledDB) ([]Shim, error) {
+	if err := os.MkdirAll(shimsDir(), 0755); err != nil {
+		return nil, err
+	}
+
+	shims, shadowed := db.Shims()
+	for _, shim := range shadowed {
+		fmt.Fprintf(os.Stderr, "Warning: '%s' of package '%s' has no shim, '%s' already uses the name.\n", shim.Name, shim.Package, shimOwner(shims, shim.Name))
+	}
+
+	wanted := make(map[string]bool)
+	for _, shim := range shims {
+		file := shimFile(shim.Name)
+		wanted[file] = true
+		if err := writeFileAtomic(filepath.Join(shimsDir(), file), shimScript(shim.Target, shim.Args), 0755); err != nil {
+			return nil, fmt.Errorf("writing shim %s: %w", shim.Name, err)
+		}
+	}
+
+	// the directory only holds shims, anything else belonged to a program
+	// that is no longer installed
+	entries, err := os.ReadDir(shimsDir())
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !wanted[entry.Name()] {
+			if err := os.RemoveAll(filepath.Join(shimsDir(), entry.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return shims, nil
+}
+
+func shimOwner(shims []Shim, name string) string {
+	for _, shim := range shims {
+		if strings.EqualFold(shim.Name, name) {
+			return shim.Package
+		}
+	}
+	return ""
+}
+
+// shimsCommand handles `boom shims rebuild`
+func shimsCommand() {
+	args := parseArgs(os.Args[2:])
+	if args.Arg(0) != "rebuild" {
+		fmt.Println("Usage: boom shims rebuild")
+		return
+	}
+
+	installed, err := loadInstalled()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	shims, err := writeShims(installed)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Printf("Rebuilt %d shims in %s.\n", len(shims), shimsDir())
+}
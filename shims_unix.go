@@ -0,0 +1,32 @@
+//go:build !windows
+
+package main
+
+import (
+	"strings"
+)
+
+// shimFile is the file name of the shim for a command
+func shimFile(name string) string {
+	return name
+}
+
+// shimScript is a shell script that replaces itself with target, run with
+// args followed by the arguments of the shim
+func shimScript(target string, args []string) []byte {
+	command := []string{"exec", shellQuote(target)}
+	for _, arg := range args {
+		command = append(command, shellQuote(arg))
+	}
+	command = append(command, `"$@"`)
+	return []byte("#!/bin/sh\n" + strings.Join(command, " ") + "\n")
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// pathHint is the line that puts the shims directory on PATH
+func pathHint() string {
+	return `export PATH="$HOME/.boom/shims:$PATH"`
+}
@@ -0,0 +1,35 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// shimFile is the file name of the shim for a command
+func shimFile(name string) string {
+	return name + ".cmd"
+}
+
+// shimScript is a batch file that runs target with args followed by the
+// arguments of the shim, and passes on its exit code
+func shimScript(target string, args []string) []byte {
+	command := []string{batchQuote(target)}
+	for _, arg := range args {
+		command = append(command, batchQuote(arg))
+	}
+	command = append(command, "%*")
+	return []byte("@echo off\r\n" + strings.Join(command, " ") + "\r\nexit /b %ERRORLEVEL%\r\n")
+}
+
+func batchQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// pathHint is the PowerShell command that puts the shims directory on the
+// user's PATH
+func pathHint() string {
+	return fmt.Sprintf(`[Environment]::SetEnvironmentVariable("Path", [Environment]::GetEnvironmentVariable("Path", "User") + ";%s", "User")`, shimsDir())
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var errNotFound = errors.New("not found")
+
+// localPath returns the filesystem path behind a file:// URL or a plain
+// path. It reports false for http(s) and other remote URLs.
+func localPath(source string) (string, bool) {
+	u, err := url.Parse(source)
+	if err != nil || u.Scheme == "" || isDriveLetter(u.Scheme) {
+		return filepath.Clean(source), true
+	}
+	if u.Scheme != "file" {
+		return "", false
+	}
+
+	path := u.Path
+	if u.Host != "" && u.Host != "localhost" {
+		// file://server/share/... is a UNC path
+		path = "//" + u.Host + path
+	}
+	if runtime.GOOS == "windows" && len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		// file:///C:/dir -> C:/dir
+		path = path[1:]
+	}
+	return filepath.FromSlash(path), true
+}
+
+// fileURL returns the file:// URL of an absolute path
+func fileURL(path string) string {
+	slashed := filepath.ToSlash(path)
+	if !strings.HasPrefix(slashed, "/") {
+		// C:/dir -> /C:/dir
+		slashed = "/" + slashed
+	}
+	return (&url.URL{Scheme: "file", Path: slashed}).String()
+}
+
+// isDriveLetter reports whether a parsed URL scheme is really a Windows drive
+// such as "C" in "C:\boom\db.json"
+func isDriveLetter(scheme string) bool {
+	return len(scheme) == 1
+}
+
+// readSource reads a small file from an http(s) URL, a file:// URL or a
+// local path. Missing files are reported with errNotFound.
+func readSource(source string) ([]byte, error) {
+	reader, _, err := openSource(source)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// openSource opens an http(s) URL, a file:// URL or a local path for reading
+// and returns its size, or -1 when the size isn't known
+func openSource(source string) (io.ReadCloser, int64, error) {
+	if path, ok := localPath(source); ok {
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			return nil, 0, fmt.Errorf("%s: %w", path, errNotFound)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, 0, err
+		}
+		if info.IsDir() {
+			file.Close()
+			return nil, 0, fmt.Errorf("%s is a directory", path)
+		}
+		return file, info.Size(), nil
+	}
+
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return nil, 0, fmt.Errorf("unsupported URL '%s'", source)
+	}
+
+	// Send an HTTP GET request to the URL
+	resp, err := http.Get(source)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("%s: %w", source, errNotFound)
+	}
+
+	// Check if the response status code is 200 OK
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("HTTP request for %s failed with status code: %d", source, resp.StatusCode)
+	}
+
+	return resp.Body, resp.ContentLength, nil
+}
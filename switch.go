@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// switchVersion makes another installed version of a package the current
+// one. Without a version it lists the installed versions.
+func switchVersion() {
+	args := parseArgs(os.Args[2:])
+	if len(args.Positional) < 1 {
+		fmt.Println("Usage: boom switch <package> [version]")
+		return
+	}
+	name, version := args.Arg(0), args.Arg(1)
+
+	installed, err := loadInstalled()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	record := installed.Find(name)
+	if record == nil {
+		fmt.Printf("Package '%s' is not installed.\n", name)
+		return
+	}
+
+	if version == "" {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Version\tCurrent")
+		for _, release := range record.Versions {
+			current := ""
+			if release.Version == record.Version {
+				current = "*"
+			}
+			fmt.Fprintf(w, "%s\t%s\n", release.Version, current)
+		}
+		w.Flush()
+		return
+	}
+
+	release, ok := record.FindRelease(version)
+	if !ok {
+		fmt.Printf("Version %s of '%s' is not installed.\n", version, name)
+		return
+	}
+	if record.Version == version {
+		fmt.Printf("Package '%s' is already on version %s.\n", name, version)
+		return
+	}
+	// like install and update, switch leaves held packages on their version
+	if record.Held {
+		fmt.Printf("Package '%s' is held at %s, run 'boom unhold %s' to switch it to %s.\n", name, record.Version, name, version)
+		return
+	}
+
+	previous := record.Version
+	record.Release = release
+	if err := installed.save(); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Printf("Package '%s' switched from %s to %s.\n", name, previous, version)
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// Transaction groups the changes of one command so they are applied together
+// or not at all. Releases are downloaded and unpacked in a staging directory
+// under ~/.boom/tmp and renamed into place, removed files are moved aside
+// instead of deleted, and installed.json is only written by Commit, after
+// every file is where it belongs. Rollback undoes each step in reverse.
+//
+// SIGINT and SIGTERM roll an open transaction back before boom exits. Each
+// rename is also written to a journal in the transaction directory first, so
+// if boom is killed outright, the next command that takes the lock can undo
+// it, see recoverTransactions.
+type Transaction struct {
+	dir       string
+	installed *InstalledDB
+	undo      []func() error
+	removed   int
+	done      bool
+
+	journal *os.File
+	signals chan os.Signal
+	// mu is held while files outside dir change, so a signal can't roll
+	// back halfway through a step
+	mu sync.Mutex
+}
+
+// journalName is the file in a transaction directory that lists its renames
+const journalName = "journal"
+
+// journalEntry is one line of the journal: a rename of Src to Dest, or the
+// sha256 of the installed.json Commit is about to write
+type journalEntry struct {
+	Src           string `json:"src,omitempty"`
+	Dest          string `json:"dest,omitempty"`
+	CreatedParent bool   `json:"created_parent,omitempty"`
+	Commit        string `json:"commit,omitempty"`
+}
+
+func tmpDir() string {
+	return filepath.Join(currentUser.HomeDir, ".boom", "tmp")
+}
+
+// beginTransaction starts a transaction that changes installed. The caller
+// keeps using installed; it is saved on Commit.
+func beginTransaction(installed *InstalledDB) (*Transaction, error) {
+	if err := os.MkdirAll(tmpDir(), 0755); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(tmpDir(), "tx-")
+	if err != nil {
+		return nil, err
+	}
+	journal, err := os.OpenFile(filepath.Join(dir, journalName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	tx := &Transaction{dir: dir, installed: installed, journal: journal, signals: make(chan os.Signal, 1)}
+	signal.Notify(tx.signals, os.Interrupt, syscall.SIGTERM)
+	go tx.rollbackOnSignal()
+	return tx, nil
+}
+
+// rollbackOnSignal rolls the transaction back and exits when boom is
+// interrupted, like a shell with 128 + signal
+func (tx *Transaction) rollbackOnSignal() {
+	sig, ok := <-tx.signals
+	if !ok {
+		return
+	}
+	tx.mu.Lock()
+	if !tx.done {
+		fmt.Fprintln(os.Stderr, "Interrupted, rolling back.")
+		tx.rollback()
+	}
+	code := 1
+	if s, ok := sig.(syscall.Signal); ok {
+		code = 128 + int(s)
+	}
+	os.Exit(code)
+}
+
+// finish stops watching for signals once the transaction is done
+func (tx *Transaction) finish() {
+	tx.done = true
+	signal.Stop(tx.signals)
+	close(tx.signals)
+	tx.journal.Close()
+}
+
+// record appends an entry to the journal and flushes it to disk, before the
+// change it describes is made
+func (tx *Transaction) record(entry journalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.journal.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return tx.journal.Sync()
+}
+
+// Install installs a release next to any other installed versions of the
+// package and makes it the current version
+func (tx *Transaction) Install(entry *IndexEntry, explicit bool) error {
+	if err := tx.InstallRelease(&entry.Manifest, nil); err != nil {
+		return err
+	}
+	tx.installed.Record(entry, explicit)
+	return nil
+}
+
+// InstallRelease downloads and unpacks a release in the staging directory,
+// lets prepare add to it, and renames it to the release's version directory
+func (tx *Transaction) InstallRelease(pkg *Manifest, prepare func(dir string) error) error {
+	fileNames, err := tx.Download([]*Manifest{pkg}, 1)
+	if err != nil {
+		return err
+	}
+	return tx.Unpack(pkg, fileNames[0], prepare)
+}
+
+func (tx *Transaction) staging(pkg *Manifest) string {
+	return filepath.Join(tx.dir, pkg.Name+"-"+pkg.Version)
+}
+
+// Download fetches the artifacts of several releases into their staging
+// directories, up to jobs at a time, and returns their file names. Once a
+// download fails no new ones are started.
+func (tx *Transaction) Download(pkgs []*Manifest, jobs int) ([]string, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		if pkg.Hash != "" {
+			continue
+		}
+		if config.requireHash() {
+			return nil, fmt.Errorf("package '%s' has no hash, its download can't be verified (set \"require_hash\": false in config.json to install it anyway)", pkg.Name)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: package '%s' has no hash, the download can't be verified.\n", pkg.Name)
+	}
+
+	progress := newProgressLines()
+	lines := make([]*progressLine, len(pkgs))
+	for i, pkg := range pkgs {
+		lines[i] = progress.Line(pkg.Name)
+	}
+
+	fileNames := make([]string, len(pkgs))
+	errs := make([]error, len(pkgs))
+	var failed atomic.Bool
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < min(max(jobs, 1), len(pkgs)); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if failed.Load() {
+					continue
+				}
+				fileNames[i], errs[i] = downloadPackage(pkgs[i], tx.staging(pkgs[i]), lines[i])
+				if errs[i] != nil {
+					lines[i].Set("failed")
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	for i := range pkgs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	// the line of the failed download names the package
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fileNames, nil
+}
+
+// Unpack runs or unpacks a downloaded release in its staging directory,
+// lets prepare add to it, and renames it to the release's version directory
+func (tx *Transaction) Unpack(pkg *Manifest, fileName string, prepare func(dir string) error) error {
+	staging := tx.staging(pkg)
+
+	// msi packages install into their final directory, after the move
+	if pkg.Install != "setup" {
+		if err := installArtifact(pkg, staging, fileName); err != nil {
+			return err
+		}
+		if err := writeReleaseFiles(staging); err != nil {
+			return err
+		}
+		if prepare != nil {
+			if err := prepare(staging); err != nil {
+				return err
+			}
+		}
+	}
+
+	// a directory nothing recorded, left by an interrupted install, is replaced
+	dest := versionDir(pkg.Name, pkg.Version)
+	if err := tx.Remove(dest); err != nil {
+		return err
+	}
+	if err := tx.move(staging, dest); err != nil {
+		return err
+	}
+
+	if pkg.Install == "setup" {
+		msiPath := filepath.Join(dest, fileName)
+		if err := installArtifact(pkg, dest, fileName); err != nil {
+			return err
+		}
+		tx.mu.Lock()
+		tx.undo = append(tx.undo, func() error {
+			return exec.Command("msiexec", "/x", "\""+msiPath+"\"", "/qb+").Run()
+		})
+		tx.mu.Unlock()
+		if err := writeReleaseFiles(dest); err != nil {
+			return err
+		}
+		if prepare != nil {
+			if err := prepare(dest); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RemovePackage uninstalls every version of a package
+func (tx *Transaction) RemovePackage(name string) error {
+	if err := tx.Remove(programDir(name)); err != nil {
+		return err
+	}
+	tx.installed.Remove(name)
+	return nil
+}
+
+// Remove moves path aside into the transaction directory. It is deleted on
+// Commit and put back on Rollback.
+func (tx *Transaction) Remove(path string) error {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return nil
+	}
+	tx.removed++
+	return tx.move(path, filepath.Join(tx.dir, "removed", strconv.Itoa(tx.removed)))
+}
+
+// move renames src to dest, creating the parent of dest if needed
+func (tx *Transaction) move(src, dest string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	parent := filepath.Dir(dest)
+	_, err := os.Stat(parent)
+	createdParent := os.IsNotExist(err)
+	if err := tx.record(journalEntry{Src: src, Dest: dest, CreatedParent: createdParent}); err != nil {
+		return fmt.Errorf("writing the transaction journal: %w", err)
+	}
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+
+	if err := os.Rename(src, dest); err != nil {
+		if createdParent {
+			os.Remove(parent)
+		}
+		return err
+	}
+
+	tx.undo = append(tx.undo, func() error {
+		if err := os.Rename(dest, src); err != nil {
+			return err
+		}
+		if createdParent {
+			return os.Remove(parent)
+		}
+		return nil
+	})
+	return nil
+}
+
+// Commit writes installed.json and deletes the staging directory along with
+// everything that was removed. If installed.json can't be written, the
+// transaction is rolled back.
+func (tx *Transaction) Commit() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	// the journal tells a later recovery whether installed.json was written
+	data, err := tx.installed.encode()
+	if err == nil {
+		sum := sha256.Sum256(data)
+		err = tx.record(journalEntry{Commit: hex.EncodeToString(sum[:])})
+	}
+	if err == nil {
+		err = tx.installed.save()
+	}
+	if err != nil {
+		tx.rollback()
+		return fmt.Errorf("writing installed.json: %w", err)
+	}
+	tx.finish()
+
+	if err := os.RemoveAll(tx.dir); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not clean up %s: %s\n", tx.dir, err)
+	}
+	return nil
+}
+
+// Rollback undoes every step in reverse order and deletes the staging
+// directory. It does nothing once the transaction is committed, so it can
+// be deferred.
+func (tx *Transaction) Rollback() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.rollback()
+}
+
+func (tx *Transaction) rollback() {
+	if tx.done {
+		return
+	}
+	tx.finish()
+
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		if err := tx.undo[i](); err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: rolling back:", err)
+		}
+	}
+	if err := os.RemoveAll(tx.dir); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not clean up %s: %s\n", tx.dir, err)
+	}
+}
+
+// recoverTransactions cleans up the transaction directories a killed boom
+// process left behind. A transaction whose installed.json was written is
+// complete and only its directory is removed; the renames of any other are
+// undone from its journal. It runs under the lock, when no transaction is
+// open.
+func recoverTransactions() {
+	dirs, err := filepath.Glob(filepath.Join(tmpDir(), "tx-*"))
+	if err != nil {
+		return
+	}
+	for _, dir := range dirs {
+		if err := recoverTransaction(dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not recover the interrupted changes in %s: %s\n", dir, err)
+		}
+	}
+}
+
+func recoverTransaction(dir string) error {
+	entries, err := readJournal(filepath.Join(dir, journalName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	committed := false
+	var moves []journalEntry
+	for _, entry := range entries {
+		if entry.Commit == "" {
+			moves = append(moves, entry)
+			continue
+		}
+		data, err := os.ReadFile(installedPath())
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		committed = hex.EncodeToString(sum[:]) == entry.Commit
+	}
+
+	if !committed && len(moves) > 0 {
+		fmt.Fprintln(os.Stderr, "Warning: rolling back the changes of an interrupted boom command.")
+		for i := len(moves) - 1; i >= 0; i-- {
+			move := moves[i]
+			// the rename may not have happened, or may have been undone
+			// already
+			if _, err := os.Lstat(move.Dest); err != nil {
+				continue
+			}
+			if _, err := os.Lstat(move.Src); err == nil {
+				return fmt.Errorf("both %s and %s exist", move.Src, move.Dest)
+			}
+			if err := os.Rename(move.Dest, move.Src); err != nil {
+				return err
+			}
+			if move.CreatedParent {
+				// only removed when empty
+				os.Remove(filepath.Dir(move.Dest))
+			}
+		}
+	}
+	return os.RemoveAll(dir)
+}
+
+func readJournal(path string) ([]journalEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []journalEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var entry journalEntry
+		// a line cut short by the crash was never acted on
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// interruptedTransaction replaces package old with a staged release of new
+// and leaves the transaction open, as if boom was killed. With committed
+// set, installed.json was written before the kill, without it the commit
+// was only about to start.
+func interruptedTransaction(t *testing.T, committed bool) {
+	t.Helper()
+	installed := &InstalledDB{Schema: installedSchemaVersion}
+	tx, err := beginTransaction(installed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if !tx.done {
+			tx.finish()
+		}
+	})
+
+	staged := filepath.Join(tx.dir, "new-1.0")
+	if err := os.MkdirAll(staged, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Remove(programDir("old")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.move(staged, versionDir("new", "1.0")); err != nil {
+		t.Fatal(err)
+	}
+
+	installed.Packages = append(installed.Packages, testInstalled("new", "1.0", true))
+	data, err := installed.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	if err := tx.record(journalEntry{Commit: hex.EncodeToString(sum[:])}); err != nil {
+		t.Fatal(err)
+	}
+	if committed {
+		if err := installed.save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRecoverTransactions(t *testing.T) {
+	for _, committed := range []bool{false, true} {
+		name := "interrupted"
+		if committed {
+			name = "committed"
+		}
+		t.Run(name, func(t *testing.T) {
+			testHome(t, "")
+			if err := os.MkdirAll(versionDir("old", "1.0"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			interruptedTransaction(t, committed)
+
+			recoverTransactions()
+
+			_, oldErr := os.Stat(versionDir("old", "1.0"))
+			_, newErr := os.Stat(programDir("new"))
+			if committed && (oldErr == nil || newErr != nil) {
+				t.Fatalf("committed changes were undone: old %v, new %v", oldErr, newErr)
+			}
+			if !committed && (oldErr != nil || newErr == nil) {
+				t.Fatalf("interrupted changes were kept: old %v, new %v", oldErr, newErr)
+			}
+			if dirs, _ := filepath.Glob(filepath.Join(tmpDir(), "tx-*")); len(dirs) != 0 {
+				t.Fatalf("left %q behind", dirs)
+			}
+		})
+	}
+}
+
+func TestRollbackRestoresReplacedPackage(t *testing.T) {
+	testHome(t, "")
+	if err := os.MkdirAll(versionDir("old", "1.0"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := beginTransaction(&InstalledDB{Schema: installedSchemaVersion})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.RemovePackage("old"); err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+
+	if _, err := os.Stat(versionDir("old", "1.0")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(tx.dir); !os.IsNotExist(err) {
+		t.Fatalf("%s was left behind", tx.dir)
+	}
+}
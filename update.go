@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+func update() {
+	args := parseArgs(os.Args[2:])
+	if len(args.Positional) < 1 && !args.Bool("all") {
+		fmt.Println("Usage: boom update <package>... | --all [--insecure] [--offline]")
+		return
+	}
+
+	installed, err := loadInstalled()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	names := args.Positional
+	if args.Bool("all") {
+		names = nil
+		for _, pkg := range installed.Packages {
+			names = append(names, pkg.Name)
+		}
+	}
+	if len(names) == 0 {
+		fmt.Println("No packages installed.")
+		return
+	}
+
+	index, err := loadIndex(IndexOptions{Insecure: args.Bool("insecure"), Offline: args.Bool("offline")})
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	for _, name := range names {
+		record := installed.Find(name)
+		if record == nil {
+			fmt.Printf("Package '%s' is not installed.\n", name)
+			continue
+		}
+
+		if record.Held {
+			if args.Bool("all") {
+				fmt.Printf("Package '%s' is held at %s, skipping.\n", name, record.Version)
+			} else {
+				fmt.Printf("Package '%s' is held at %s, run 'boom unhold %s' to update it.\n", name, record.Version, name)
+			}
+			continue
+		}
+
+		entry, ok := availableUpdate(index, record)
+		if !ok {
+			fmt.Printf("Package '%s' is up to date (%s).\n", name, record.Version)
+			continue
+		}
+
+		fmt.Printf("Updating '%s' %s -> %s\n", name, record.Version, entry.Version)
+		if err := upgradePackage(index, record, entry); err != nil {
+			fmt.Printf("Error updating package '%s': %s\n", name, err)
+			continue
+		}
+		fmt.Printf("Package '%s' updated to %s.\n", name, entry.Version)
+	}
+}
+
+// latestEntry returns the registry entry an installed package tracks: the
+// one from the registry it was installed from, or the highest priority one
+// if that registry is gone. Nothing is returned while its registry can't be
+// loaded, so the package doesn't silently move to another registry.
+func latestEntry(index *MergedIndex, record *InstalledPackage) (*IndexEntry, bool) {
+	if slices.Contains(index.Skipped, record.Registry) {
+		return nil, false
+	}
+	if record.Registry != "" {
+		if entry, ok := index.Find(record.Registry + "/" + record.Name); ok {
+			return entry, true
+		}
+	}
+	return index.Find(record.Name)
+}
+
+// availableUpdate returns the registry entry for an installed package when
+// it has a newer version
+func availableUpdate(index *MergedIndex, record *InstalledPackage) (*IndexEntry, bool) {
+	entry, ok := latestEntry(index, record)
+	if !ok || compareVersions(entry.Version, record.Version) <= 0 {
+		return nil, false
+	}
+	latest, err := entry.Resolve("latest")
+	if err != nil {
+		return nil, false
+	}
+	return latest, true
+}
+
+// upgradePackage installs a new release next to the current one and makes
+// it current, first installing any dependencies the new release adds. The
+// previous version stays installed for `boom switch`, and files the program
+// created in its directory are copied over to the new one. Nothing changes
+// unless every step succeeds.
+func upgradePackage(index *MergedIndex, record *InstalledPackage, entry *IndexEntry) error {
+	pkg := &entry.Manifest
+
+	installed, err := loadInstalled()
+	if err != nil {
+		return err
+	}
+	dependencies, err := resolveDependencies(index, installed, entry)
+	if err != nil {
+		return fmt.Errorf("resolving dependencies: %w", err)
+	}
+	conflicting, err := findConflicts(installed, append(dependencies, entry), record.Name)
+	if err != nil {
+		return err
+	}
+	if len(conflicting) > 0 {
+		return fmt.Errorf("version %s conflicts with installed %s", pkg.Version, quoteNames(conflicting))
+	}
+
+	tx, err := beginTransaction(installed)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, dependency := range dependencies {
+		fmt.Printf("Installing dependency '%s' %s\n", dependency.Name, dependency.Version)
+		if err := tx.Install(dependency, false); err != nil {
+			return fmt.Errorf("installing dependency '%s': %w", dependency.Name, err)
+		}
+	}
+
+	// the new version may already be installed side by side
+	if _, ok := record.FindRelease(pkg.Version); !ok {
+		oldDir := record.Dir()
+		err := tx.InstallRelease(pkg, func(dir string) error {
+			return copyUserFiles(oldDir, dir)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	installed.Record(entry, false)
+	return tx.Commit()
+}
+
+// releaseFilesName is the file in a version directory that lists what the
+// release itself installed, one slash separated path per line
+const releaseFilesName = ".boom-files"
+
+// writeReleaseFiles records every file in a freshly installed version
+// directory as part of the release
+func writeReleaseFiles(dir string) error {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, releaseFilesName), []byte(strings.Join(files, "\n")+"\n"), 0644)
+}
+
+// readReleaseFiles returns the files a release installed, or nil when the
+// version directory predates the list
+func readReleaseFiles(dir string) (map[string]bool, error) {
+	data, err := os.ReadFile(filepath.Join(dir, releaseFilesName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]bool{releaseFilesName: true}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			files[line] = true
+		}
+	}
+	return files, nil
+}
+
+// copyUserFiles copies the files the program created in sourceDir, such as
+// settings, to destDir. Files of the old release itself are left behind, so
+// old libraries and plugins can't break the new one, and so are files
+// destDir already has.
+func copyUserFiles(sourceDir, destDir string) error {
+	releaseFiles, err := readReleaseFiles(sourceDir)
+	if err != nil {
+		return err
+	}
+	if releaseFiles == nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s has no %s, its files are not carried over to the new version.\n", sourceDir, releaseFilesName)
+		return nil
+	}
+
+	return filepath.WalkDir(sourceDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+		if releaseFiles[filepath.ToSlash(rel)] {
+			return nil
+		}
+
+		dest := filepath.Join(destDir, rel)
+		if _, err := os.Lstat(dest); err == nil {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		return copyFile(path, dest, info.Mode().Perm())
+	})
+}
+
+func copyFile(source, dest string, perm fs.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}